@@ -0,0 +1,121 @@
+package method
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/linecard/self/cmd/cli/param"
+	"github.com/linecard/self/pkg/convention/config"
+	rtype "github.com/linecard/self/pkg/convention/release"
+	"github.com/linecard/self/pkg/sdk"
+	"github.com/linecard/self/pkg/service/gateway"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/rs/zerolog/log"
+)
+
+type accountResult struct {
+	Account    string
+	Deployment string
+	Err        error
+}
+
+// Deploy one release from the shared registry into many accounts, assuming a role in each. The registry
+// is the one already discovered, which each account's functions must be allowed to pull from.
+func deployToAccounts(ctx context.Context, api sdk.API, p *param.Deploy, release rtype.Release) error {
+	var wg sync.WaitGroup
+	var accounts []string
+
+	if p.AssumeRoleName == "" {
+		return fmt.Errorf("--accounts requires --assume-role-name")
+	}
+
+	for _, account := range p.Accounts {
+		for _, id := range strings.Split(account, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				accounts = append(accounts, id)
+			}
+		}
+	}
+
+	results := make([]accountResult, len(accounts))
+	wg.Add(len(accounts))
+
+	for i, account := range accounts {
+		go func(i int, account string) {
+			defer wg.Done()
+			results[i] = deployToAccount(ctx, api, p, release, account)
+		}(i, account)
+	}
+
+	wg.Wait()
+
+	var failed int
+	t := table.New()
+	t.Headers("ACCOUNT", "DEPLOYMENT", "STATUS", "ERROR")
+
+	for _, result := range results {
+		status, message := "Succeeded", ""
+		if result.Err != nil {
+			failed++
+			status, message = "Failed", result.Err.Error()
+		}
+		t.Row(result.Account, result.Deployment, status, message)
+	}
+
+	fmt.Println(t.Render())
+
+	if failed > 0 {
+		return fmt.Errorf("deployment failed in %d of %d accounts", failed, len(accounts))
+	}
+
+	return nil
+}
+
+func deployToAccount(ctx context.Context, api sdk.API, p *param.Deploy, release rtype.Release, account string) (result accountResult) {
+	ctx, span := otel.Tracer("").Start(ctx, "deploy-account")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("account", account),
+		attribute.String("role-name", p.AssumeRoleName),
+	)
+
+	result.Account = account
+	awsConfig := config.AssumeAccountRole(api.Config.AwsConfig, account, p.AssumeRoleName)
+
+	gws := gateway.FromClients(apigatewayv2.NewFromConfig(awsConfig))
+
+	cfg, err := api.Config.ForAccount(ctx, awsConfig, sts.NewFromConfig(awsConfig), gws)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	if cfg.Account.Id != account {
+		result.Err = fmt.Errorf("assumed role resolved to account %s", cfg.Account.Id)
+		return
+	}
+
+	accountApi, err := sdk.Init(ctx, awsConfig, cfg)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	deployment, err := deployRelease(ctx, accountApi, p, release)
+	if err != nil {
+		log.Error().Err(err).Str("account", account).Msg("failed to deploy release")
+		result.Err = err
+		return
+	}
+
+	result.Deployment = *deployment.Configuration.FunctionName
+	return
+}
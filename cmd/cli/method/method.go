@@ -7,12 +7,14 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang-module/carbon/v2"
 	"github.com/linecard/self/cmd/cli/param"
 	"github.com/linecard/self/internal/util"
 	"github.com/linecard/self/pkg/convention/config"
 	dtype "github.com/linecard/self/pkg/convention/deployment"
+	rtype "github.com/linecard/self/pkg/convention/release"
 	"github.com/linecard/self/pkg/sdk"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -34,7 +36,7 @@ func BuildRelease(ctx context.Context, api sdk.API, p *param.Build) error {
 		p.Context = p.Path
 	}
 
-	image, _, err := api.Release.Build(ctx, p.Path, p.Context)
+	image, _, err := api.Release.Build(ctx, p.Path, p.Context, buildOptions(p))
 	if err != nil {
 		return err
 	}
@@ -48,6 +50,15 @@ func BuildRelease(ctx context.Context, api sdk.API, p *param.Build) error {
 	return nil
 }
 
+func buildOptions(p *param.Build) rtype.BuildOptions {
+	return rtype.BuildOptions{
+		Args:    p.BuildArg,
+		Secrets: p.Secret,
+		Ssh:     p.SSHAgent,
+		Cache:   p.Cache,
+	}
+}
+
 func PublishRelease(ctx context.Context, api sdk.API, p *param.Publish) error {
 	ctx, span := otel.Tracer("").Start(ctx, "release")
 	defer span.End()
@@ -56,18 +67,22 @@ func PublishRelease(ctx context.Context, api sdk.API, p *param.Publish) error {
 		p.Context = p.Path
 	}
 
+	if p.Image != "" {
+		return publishArchive(ctx, api, p)
+	}
+
 	if p.Login {
 		if err := api.Account.LoginToEcr(ctx); err != nil {
 			return err
 		}
 	}
 
-	image, buildtime, err := api.Release.Build(ctx, p.Path, p.Context)
+	image, buildtime, err := api.Release.Build(ctx, p.Path, p.Context, buildOptions(&p.Build))
 	if err != nil {
 		return err
 	}
 
-	if p.EnsureRepository {
+	if p.EnsureRepository && image.Zip == "" {
 		if err := api.Release.EnsureRepository(ctx, buildtime.Computed.Repository.Name); err != nil {
 			return err
 		}
@@ -81,31 +96,57 @@ func PublishRelease(ctx context.Context, api sdk.API, p *param.Publish) error {
 		return err
 	}
 
-	if p.EmitDeploy {
-		ctx, span := otel.Tracer("").Start(ctx, "notify")
-		defer span.End()
-
-		carrier := propagation.MapCarrier{}
-		otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return emitDeploy(ctx, api, p, buildtime)
+}
 
-		detail := config.EventDetail{
-			Traceparent:    carrier["traceparent"],
-			Tracestate:     carrier["tracestate"],
-			Action:         "Deploy",
-			Sha:            buildtime.Sha.Decoded,
-			Branch:         buildtime.Branch.Decoded,
-			Origin:         buildtime.Origin.Decoded,
-			RepositoryName: buildtime.Computed.Repository.Name,
-			ResourceName:   buildtime.Computed.Resource.Name,
-			ExceptAccounts: p.ExceptAccounts,
-		}
+// publishArchive pushes a prebuilt image without docker, so no login or local build is involved.
+func publishArchive(ctx context.Context, api sdk.API, p *param.Publish) error {
+	buildtime, err := api.Config.BuildTime(p.Path)
+	if err != nil {
+		return err
+	}
 
-		if err := api.Bus.Emit(ctx, detail); err != nil {
+	if p.EnsureRepository {
+		if err := api.Release.EnsureRepository(ctx, buildtime.Computed.Repository.Name); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if api.Config.Git.Dirty && !p.Force {
+		log.Fatal().Msg("git is dirty, please commit changes before publishing")
+	}
+
+	if buildtime, err = api.Release.PublishArchive(ctx, p.Path, p.Image); err != nil {
+		return err
+	}
+
+	return emitDeploy(ctx, api, p, buildtime)
+}
+
+func emitDeploy(ctx context.Context, api sdk.API, p *param.Publish, buildtime config.BuildTime) error {
+	if !p.EmitDeploy {
+		return nil
+	}
+
+	ctx, span := otel.Tracer("").Start(ctx, "notify")
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	detail := config.EventDetail{
+		Traceparent:    carrier["traceparent"],
+		Tracestate:     carrier["tracestate"],
+		Action:         "Deploy",
+		Sha:            buildtime.Sha.Decoded,
+		Branch:         buildtime.Branch.Decoded,
+		Origin:         buildtime.Origin.Decoded,
+		RepositoryName: buildtime.Computed.Repository.Name,
+		ResourceName:   buildtime.Computed.Resource.Name,
+		ExceptAccounts: p.ExceptAccounts,
+	}
+
+	return api.Bus.Emit(ctx, detail)
 }
 
 func DeployRelease(ctx context.Context, api sdk.API, p *param.Deploy) error {
@@ -123,32 +164,57 @@ func DeployRelease(ctx context.Context, api sdk.API, p *param.Deploy) error {
 		return err
 	}
 
-	deployment, err := api.Deployment.Deploy(ctx, release)
+	if len(p.Accounts) > 0 {
+		return deployToAccounts(ctx, api, p, release)
+	}
+
+	_, err = deployRelease(ctx, api, p, release)
+	return err
+}
+
+func deployRelease(ctx context.Context, api sdk.API, p *param.Deploy, release rtype.Release) (deployment dtype.Deployment, err error) {
+	record := api.History.Begin(ctx, release)
+	defer func() {
+		if historyErr := api.History.Finish(ctx, record, err); historyErr != nil {
+			log.Warn().Err(historyErr).Msg("failed to record deployment history")
+		}
+	}()
+
+	// Gated after the record is opened, so blocked releases show in the history too.
+	if err = api.Scan.Gate(ctx, release); err != nil {
+		return deployment, err
+	}
+
+	deployment, err = api.Deployment.Deploy(ctx, release)
 	if err != nil {
-		return err
+		return deployment, err
 	}
 
 	if p.Enable {
 		if err = api.Subscription.EnableAll(ctx, deployment); err != nil {
-			return err
+			return deployment, err
 		}
 	}
 
 	if p.Disable {
 		if err = api.Subscription.DisableAll(ctx, deployment); err != nil {
-			return err
+			return deployment, err
 		}
 	}
 
 	if err = api.Subscription.Converge(ctx, deployment); err != nil {
-		return err
+		return deployment, err
 	}
 
 	if err = api.Httproxy.Converge(ctx, deployment); err != nil {
-		return err
+		return deployment, err
 	}
 
-	return nil
+	if err = api.Permission.Converge(ctx, deployment); err != nil {
+		return deployment, err
+	}
+
+	return deployment, nil
 }
 
 func DestroyDeployment(ctx context.Context, api sdk.API, p *param.Destroy) error {
@@ -177,6 +243,36 @@ func DestroyDeployment(ctx context.Context, api sdk.API, p *param.Destroy) error
 	return nil
 }
 
+func PruneVersions(ctx context.Context, api sdk.API, p *param.Gc) error {
+	keep := api.Config.Versions.Keep
+	if p.Keep != nil {
+		keep = *p.Keep
+	}
+
+	// Zero disables pruning on deploy, it never means deleting every version.
+	if keep < 1 {
+		return fmt.Errorf("--keep must be at least 1, got %d, pruning is disabled when %s is 0", keep, config.EnvKeepVersions)
+	}
+
+	buildtime, err := api.Config.BuildTime(p.FunctionArg.Path)
+	if err != nil {
+		return err
+	}
+
+	deployment, err := api.Deployment.Find(ctx, buildtime.Computed.Resource.Name)
+	if err != nil {
+		return err
+	}
+
+	pruned, err := api.Deployment.Prune(ctx, deployment, keep)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("pruned %d versions of %s\n", len(pruned), buildtime.Computed.Resource.Name)
+	return nil
+}
+
 func UntagRelease(ctx context.Context, api sdk.API, p *param.Untag) error {
 	ctx, span := otel.Tracer("").Start(ctx, "release")
 	defer span.End()
@@ -240,20 +336,47 @@ func ListReleases(ctx context.Context, api sdk.API, p *param.Releases) error {
 		return err
 	}
 
-	t.Headers("HEAD", "SHA", "DIGEST", "RELEASED")
+	releases, err = api.Release.Describe(ctx, buildtime.Computed.Repository.Name, releases)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"HEAD", "SHA", "DIGEST", "AUTHOR", "SUBJECT", "RELEASED"}
+	if p.Long {
+		headers = append(headers, "RUN", "SELF")
+	}
+
+	t.Headers(headers...)
 	for _, release := range releases {
-		t.Row(
+		author, _, _ := strings.Cut(release.Provenance.Author, " <")
+		row := []string{
 			release.Branch,
 			util.UnsafeSlice(release.GitSha, 0, 8),
 			util.UnsafeSlice(release.ImageDigest, 7, 15),
+			author,
+			truncate(release.Provenance.Subject, 48),
 			carbon.Parse(release.Released).DiffForHumans(),
-		)
+		}
+
+		if p.Long {
+			row = append(row, release.Provenance.RunUrl, release.Provenance.SelfVersion)
+		}
+
+		t.Row(row...)
 	}
 
 	fmt.Println(t.Render())
 	return nil
 }
 
+// truncate shortens s to n runes for display.
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
+
 func ListDeployments(ctx context.Context, api sdk.API, p *param.Deployments) error {
 	var wg sync.WaitGroup
 	t := table.New()
@@ -316,6 +439,36 @@ func ListDeployments(ctx context.Context, api sdk.API, p *param.Deployments) err
 	return nil
 }
 
+func ListHistory(ctx context.Context, api sdk.API, p *param.History) error {
+	t := table.New()
+
+	buildtime, err := api.Config.BuildTime(p.FunctionArg.Path)
+	if err != nil {
+		return err
+	}
+
+	records, err := api.History.List(ctx, buildtime.Computed.Resource.Name, buildtime.Computed.Repository.Name)
+	if err != nil {
+		return err
+	}
+
+	t.Headers("DEPLOYED", "SHA", "DIGEST", "CALLER", "OUTCOME", "DURATION", "TRACE")
+	for _, record := range records {
+		t.Row(
+			carbon.CreateFromStdTime(record.Deployed).DiffForHumans(),
+			util.UnsafeSlice(record.Sha, 0, 8),
+			util.UnsafeSlice(record.Digest, 7, 15),
+			record.Caller,
+			record.Outcome,
+			record.Duration.Round(time.Second).String(),
+			record.TraceId,
+		)
+	}
+
+	fmt.Println(t.Render())
+	return nil
+}
+
 func PrintGlobalConfig(ctx context.Context, api sdk.API) error {
 	cJson, err := json.Marshal(api.Config)
 	if err != nil {
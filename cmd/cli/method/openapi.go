@@ -0,0 +1,39 @@
+package method
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/linecard/self/cmd/cli/param"
+	"github.com/linecard/self/pkg/sdk"
+	"gopkg.in/yaml.v3"
+)
+
+func ExportOpenApi(ctx context.Context, api sdk.API, p *param.OpenApi) error {
+	var content []byte
+
+	document, err := api.OpenApi.Compose(ctx)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(p.Output, ".json") {
+		content, err = json.MarshalIndent(document, "", "  ")
+	} else {
+		content, err = yaml.Marshal(document)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if p.Output == "" {
+		fmt.Print(string(content))
+		return nil
+	}
+
+	return os.WriteFile(p.Output, content, 0644)
+}
@@ -0,0 +1,85 @@
+package method
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/linecard/self/cmd/cli/param"
+	rtype "github.com/linecard/self/pkg/convention/release"
+	"github.com/linecard/self/pkg/convention/runtime"
+	"github.com/linecard/self/pkg/sdk"
+
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/rs/zerolog/log"
+)
+
+func ServeFunctions(ctx context.Context, api sdk.API, p *param.Serve) error {
+	var upstreams []runtime.Upstream
+	t := table.New()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(api.Config.Selfish)+1)
+
+	t.Headers("ROUTE", "FUNCTION", "PORT")
+	for i, selfish := range api.Config.Selfish {
+		if selfish.Package == "zip" {
+			log.Info().Msgf("%s is a zip package, skipping", selfish.Name)
+			continue
+		}
+
+		image, _, err := api.Release.Build(ctx, selfish.Path, selfish.Path, rtype.BuildOptions{})
+		if err != nil {
+			return err
+		}
+
+		deploytime, err := api.Config.DeployTime(image.Config.Labels)
+		if err != nil {
+			return err
+		}
+
+		if !deploytime.Computed.Resources.Http {
+			log.Info().Msgf("%s is not http enabled, skipping", selfish.Name)
+			continue
+		}
+
+		port := p.BasePort + i
+		for _, route := range deploytime.Computed.Resources.Routes {
+			upstreams = append(upstreams, runtime.Upstream{Route: route, Port: port})
+			t.Row(route.RouteKey, selfish.Name, strconv.Itoa(port))
+		}
+
+		go func() {
+			errs <- api.Runtime.EmulateOnPort(ctx, image, port)
+		}()
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", p.Port),
+		Handler: api.Runtime.Proxy(upstreams),
+	}
+
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	fmt.Println(t.Render())
+	log.Info().Msgf("serving on http://localhost:%d", p.Port)
+
+	err := <-errs
+	cancel()
+
+	if shutdownErr := server.Shutdown(context.Background()); shutdownErr != nil {
+		log.Warn().Err(shutdownErr).Msg("failed to shut down proxy")
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
@@ -1,18 +1,42 @@
 package param
 
 type GlobalOpts struct {
-	Branch                 string `arg:"--branch,env:SELF_BRANCH_OVERRIDE"`
-	Sha                    string `arg:"--sha,env:SELF_SHA_OVERRIDE"`
-	EcrId                  string `arg:"--ecr-id,env:SELF_ECR_REGISTRY_ID"`
-	EcrRegion              string `arg:"--ecr-region,env:SELF_ECR_REGISTRY_REGION"`
-	ApiGatewayId           string `arg:"--api-gateway-id,env:SELF_API_GATEWAY_ID"`
-	ApiGatewayAuthType     string `arg:"--api-gateway-auth-type,env:SELF_API_GATEWAY_AUTH_TYPE"`
-	ApiGatewayAuthorizerId string `arg:"--api-gateway-authorizer-id,env:SELF_API_GATEWAY_AUTHORIZER_ID"`
-	SelfBusName            string `arg:"--bus-name,env:SELF_SELF_BUS_NAME"`
-	SubnetIds              string `arg:"--subnet-ids,env:SELF_SUBNET_IDS"`
-	SecurityGroupIds       string `arg:"--security-group-ids,env:SELF_SECURITY_GROUP_IDS"`
-	OwnerPrefixResources   bool   `arg:"--prefix-resources-with-owner,env:SELF_PREFIX_RESOURCES_WITH_OWNER"`
-	OwnerPrefixRoutes      bool   `arg:"--prefix-routes-with-owner,env:SELF_PREFIX_ROUTE_KEY_WITH_OWNER"`
+	Branch                  string `arg:"--branch,env:SELF_BRANCH_OVERRIDE"`
+	Sha                     string `arg:"--sha,env:SELF_SHA_OVERRIDE"`
+	EcrId                   string `arg:"--ecr-id,env:SELF_ECR_REGISTRY_ID"`
+	EcrRegion               string `arg:"--ecr-region,env:SELF_ECR_REGISTRY_REGION"`
+	RegistryUrl             string `arg:"--registry-url,env:SELF_REGISTRY_URL"`
+	ApiGatewayId            string `arg:"--api-gateway-id,env:SELF_API_GATEWAY_ID"`
+	ApiGatewayDiscoveryName string `arg:"--api-gateway-discovery-name,env:SELF_API_GATEWAY_DISCOVERY_NAME"`
+	ApiGatewayStage         string `arg:"--api-gateway-stage,env:SELF_API_GATEWAY_STAGE"`
+	DomainName              string `arg:"--domain-name,env:SELF_API_GATEWAY_DOMAIN_NAME"`
+	DomainBasePath          string `arg:"--domain-base-path,env:SELF_API_GATEWAY_DOMAIN_BASE_PATH"`
+	DomainCertificateArn    string `arg:"--domain-certificate-arn,env:SELF_API_GATEWAY_DOMAIN_CERTIFICATE_ARN"`
+	ApiGatewayAuthType      string `arg:"--api-gateway-auth-type,env:SELF_API_GATEWAY_AUTH_TYPE"`
+	ApiGatewayAuthorizerId  string `arg:"--api-gateway-authorizer-id,env:SELF_API_GATEWAY_AUTHORIZER_ID"`
+	SelfBusName             string `arg:"--bus-name,env:SELF_SELF_BUS_NAME"`
+	HistoryTable            string `arg:"--history-table,env:SELF_HISTORY_TABLE"`
+	HistoryPath             string `arg:"--history-path,env:SELF_HISTORY_PATH"`
+	HistoryBucket           string `arg:"--history-bucket,env:SELF_HISTORY_BUCKET"`
+	SubnetIds               string `arg:"--subnet-ids,env:SELF_SUBNET_IDS"`
+	SecurityGroupIds        string `arg:"--security-group-ids,env:SELF_SECURITY_GROUP_IDS"`
+	OwnerPrefixResources    bool   `arg:"--prefix-resources-with-owner,env:SELF_PREFIX_RESOURCES_WITH_OWNER"`
+	OwnerPrefixRoutes       bool   `arg:"--prefix-routes-with-owner,env:SELF_PREFIX_ROUTE_KEY_WITH_OWNER"`
+	KeepVersions            *int   `arg:"--keep-versions,env:SELF_KEEP_VERSIONS"`
+	DiskCache               string `arg:"--disk-cache,env:SELF_DISK_CACHE"`
+	Builder                 string `arg:"--builder,env:SELF_BUILDER"`
+	BuildPlatform           string `arg:"--platform,env:SELF_BUILD_PLATFORM"`
+	BuildkitHost            string `arg:"--buildkit-host,env:SELF_BUILDKIT_HOST"`
+	CompressLabels          bool   `arg:"--compress-labels,env:SELF_COMPRESS_LABELS"`
+	PackageBucket           string `arg:"--package-bucket,env:SELF_PACKAGE_BUCKET"`
+	ScanSeverity            string `arg:"--scan-severity,env:SELF_SCAN_SEVERITY"`
+	ScanAllowlist           string `arg:"--scan-allowlist,env:SELF_SCAN_ALLOWLIST"`
+	PullAccounts            string `arg:"--pull-accounts,env:SELF_ECR_PULL_ACCOUNTS"`
+	ExpireUntaggedDays      string `arg:"--expire-untagged-days,env:SELF_ECR_EXPIRE_UNTAGGED_DAYS"`
+	ImmutableShaTags        bool   `arg:"--immutable-sha-tags,env:SELF_ECR_IMMUTABLE_SHA_TAGS"`
+	CiRunUrl                string `arg:"--ci-run-url,env:SELF_CI_RUN_URL"`
+	SigningKey              string `arg:"--signing-key,env:SELF_SIGNING_KEY"`
+	TrustedKeys             string `arg:"--trusted-keys,env:SELF_TRUSTED_KEYS"`
 }
 
 type FunctionArg struct {
@@ -25,9 +49,12 @@ type Init struct {
 }
 
 type Build struct {
-	SSHAgent bool   `arg:"-a,--ssh-agent" help:"mount ssh-agent into build (not yet implemented)"`
-	Context  string `arg:"-c,--context" help:"set builtime path, defaults to arg path."`
-	Run      bool   `arg:"--run" help:"run the function locally after building"`
+	SSHAgent bool     `arg:"-a,--ssh-agent" help:"forward the ssh agent into the build as the default ssh mount"`
+	BuildArg []string `arg:"--build-arg,separate" help:"KEY=VALUE build argument, templated like resources.json"`
+	Secret   []string `arg:"--secret,separate" help:"BuildKit secret, e.g. id=npm,env=NPM_TOKEN or id=netrc,src=.netrc"`
+	Cache    bool     `arg:"--cache,env:SELF_BUILD_CACHE" help:"cache layers in the function's repository"`
+	Context  string   `arg:"-c,--context" help:"set builtime path, defaults to arg path."`
+	Run      bool     `arg:"--run" help:"run the function locally after building"`
 	FunctionArg
 }
 
@@ -37,12 +64,15 @@ type Publish struct {
 	Force            bool     `arg:"-f,--force" help:"Override dirty commit protection"`
 	EmitDeploy       bool     `arg:"--emit-deploy,env:SELF_EMIT_DEPLOY_ON_PUBLISH" help:"Emit deploy event"`
 	ExceptAccounts   []string `arg:"--except" help:"Exclude deployment to these accounts when emitting deploy event"`
+	Image            string   `arg:"--image" help:"push this OCI layout or image tarball instead of building with docker"`
 	Build
 }
 
 type Deploy struct {
-	Enable  bool `arg:"--enable,env:SELF_ENABLE_ON_DEPLOY" help:"enable event bus invocation"`
-	Disable bool `arg:"--disable,env:SELF_DISABLE_ON_DEPLOY" help:"disable event bus invocation"`
+	Enable         bool     `arg:"--enable,env:SELF_ENABLE_ON_DEPLOY" help:"enable event bus invocation"`
+	Disable        bool     `arg:"--disable,env:SELF_DISABLE_ON_DEPLOY" help:"disable event bus invocation"`
+	Accounts       []string `arg:"--accounts,env:SELF_DEPLOY_ACCOUNTS" help:"deploy to these accounts instead of the current one, requires SELF_ECR_REGISTRY_ID"`
+	AssumeRoleName string   `arg:"--assume-role-name,env:SELF_DEPLOY_ROLE_NAME" help:"role to assume in each of --accounts"`
 	FunctionArg
 }
 
@@ -52,12 +82,31 @@ type Destroy struct {
 
 type Releases struct {
 	FunctionArg
+	Long bool `arg:"-l,--long" help:"also show the CI run and self version that built each release"`
 }
 
 type Deployments struct {
 	FunctionArg
 }
 
+type Gc struct {
+	Keep *int `arg:"--keep" help:"number of published versions to keep, at least 1, defaults to SELF_KEEP_VERSIONS"`
+	FunctionArg
+}
+
+type Serve struct {
+	Port     int `arg:"-p,--port" default:"8080" help:"port to serve the emulated api gateway on"`
+	BasePort int `arg:"--base-port" default:"9000" help:"first port of the emulated functions"`
+}
+
+type OpenApi struct {
+	Output string `arg:"-o,--output" help:"write the document to a file, as json if it ends in .json"`
+}
+
+type History struct {
+	FunctionArg
+}
+
 type DeployTime struct {
 	FunctionArg
 }
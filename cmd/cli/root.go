@@ -10,10 +10,12 @@ import (
 	"github.com/linecard/self/internal/util"
 	"github.com/linecard/self/pkg/convention/config"
 	"github.com/linecard/self/pkg/sdk"
+	"github.com/linecard/self/pkg/service/gateway"
 	"go.opentelemetry.io/otel"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/rs/zerolog"
@@ -46,13 +48,14 @@ func Invoke() {
 
 	stsc = sts.NewFromConfig(awsConfig)
 	ecrc := ecr.NewFromConfig(awsConfig)
+	gws := gateway.FromClients(apigatewayv2.NewFromConfig(awsConfig))
 
 	var root router.Root
 	arg.MustParse(&root)
 
 	configEnv(root)
 
-	if cfg, err = config.Stateful(ctx, awsConfig, stsc, ecrc); err != nil {
+	if cfg, err = config.Stateful(ctx, awsConfig, stsc, ecrc, gws); err != nil {
 		log.Fatal().Err(err).Msg("failed to load configuration from cwd")
 	}
 
@@ -83,6 +86,10 @@ func configEnv(root router.Root) {
 		os.Setenv(config.EnvEcrRegion, root.GlobalOpts.EcrRegion)
 	}
 
+	if root.GlobalOpts.RegistryUrl != "" {
+		os.Setenv(config.EnvRegistryUrl, root.GlobalOpts.RegistryUrl)
+	}
+
 	if root.GlobalOpts.SubnetIds != "" {
 		os.Setenv(config.EnvSnIds, root.GlobalOpts.SubnetIds)
 	}
@@ -108,4 +115,96 @@ func configEnv(root router.Root) {
 	if root.GlobalOpts.SelfBusName != "" {
 		os.Setenv(config.EnvBusName, root.GlobalOpts.SelfBusName)
 	}
+
+	if root.GlobalOpts.KeepVersions != nil {
+		os.Setenv(config.EnvKeepVersions, strconv.Itoa(*root.GlobalOpts.KeepVersions))
+	}
+
+	if root.GlobalOpts.ApiGatewayDiscoveryName != "" {
+		os.Setenv(config.EnvGwDiscoveryName, root.GlobalOpts.ApiGatewayDiscoveryName)
+	}
+
+	if root.GlobalOpts.ApiGatewayStage != "" {
+		os.Setenv(config.EnvGwStage, root.GlobalOpts.ApiGatewayStage)
+	}
+
+	if root.GlobalOpts.DomainName != "" {
+		os.Setenv(config.EnvDomainName, root.GlobalOpts.DomainName)
+	}
+
+	if root.GlobalOpts.DomainBasePath != "" {
+		os.Setenv(config.EnvDomainBasePath, root.GlobalOpts.DomainBasePath)
+	}
+
+	if root.GlobalOpts.DomainCertificateArn != "" {
+		os.Setenv(config.EnvDomainCertificateArn, root.GlobalOpts.DomainCertificateArn)
+	}
+
+	if root.GlobalOpts.HistoryTable != "" {
+		os.Setenv(config.EnvHistoryTable, root.GlobalOpts.HistoryTable)
+	}
+
+	if root.GlobalOpts.HistoryBucket != "" {
+		os.Setenv(config.EnvHistoryBucket, root.GlobalOpts.HistoryBucket)
+	}
+
+	if root.GlobalOpts.HistoryPath != "" {
+		os.Setenv(config.EnvHistoryPath, root.GlobalOpts.HistoryPath)
+	}
+
+	if root.GlobalOpts.DiskCache != "" {
+		os.Setenv(config.EnvDiskCache, root.GlobalOpts.DiskCache)
+	}
+
+	if root.GlobalOpts.Builder != "" {
+		os.Setenv(config.EnvBuilder, root.GlobalOpts.Builder)
+	}
+
+	if root.GlobalOpts.BuildPlatform != "" {
+		os.Setenv(config.EnvBuildPlatform, root.GlobalOpts.BuildPlatform)
+	}
+
+	if root.GlobalOpts.BuildkitHost != "" {
+		os.Setenv(config.EnvBuildkitHost, root.GlobalOpts.BuildkitHost)
+	}
+
+	if root.GlobalOpts.CompressLabels {
+		os.Setenv(config.EnvCompressLabels, strconv.FormatBool(root.GlobalOpts.CompressLabels))
+	}
+
+	if root.GlobalOpts.PackageBucket != "" {
+		os.Setenv(config.EnvPackageBucket, root.GlobalOpts.PackageBucket)
+	}
+
+	if root.GlobalOpts.ScanSeverity != "" {
+		os.Setenv(config.EnvScanSeverity, root.GlobalOpts.ScanSeverity)
+	}
+
+	if root.GlobalOpts.ScanAllowlist != "" {
+		os.Setenv(config.EnvScanAllowlist, root.GlobalOpts.ScanAllowlist)
+	}
+
+	if root.GlobalOpts.PullAccounts != "" {
+		os.Setenv(config.EnvPullAccounts, root.GlobalOpts.PullAccounts)
+	}
+
+	if root.GlobalOpts.ExpireUntaggedDays != "" {
+		os.Setenv(config.EnvExpireUntaggedDays, root.GlobalOpts.ExpireUntaggedDays)
+	}
+
+	if root.GlobalOpts.CiRunUrl != "" {
+		os.Setenv(config.EnvCiRunUrl, root.GlobalOpts.CiRunUrl)
+	}
+
+	if root.GlobalOpts.SigningKey != "" {
+		os.Setenv(config.EnvSigningKey, root.GlobalOpts.SigningKey)
+	}
+
+	if root.GlobalOpts.TrustedKeys != "" {
+		os.Setenv(config.EnvTrustedKeys, root.GlobalOpts.TrustedKeys)
+	}
+
+	if root.GlobalOpts.ImmutableShaTags {
+		os.Setenv(config.EnvImmutableShaTags, strconv.FormatBool(root.GlobalOpts.ImmutableShaTags))
+	}
 }
@@ -20,8 +20,12 @@ type Root struct {
 	Destroy     *param.Destroy     `arg:"subcommand:destroy" help:"Destroy a release deployment"`
 	Releases    *param.Releases    `arg:"subcommand:releases" help:"List releases"`
 	Deployments *param.Deployments `arg:"subcommand:deployments" help:"List release deployments"`
+	History     *param.History     `arg:"subcommand:history" help:"List deployment history"`
 	Inspect     *param.Inspect     `arg:"subcommand:inspect" help:"Inspect config"`
 	Untag       *param.Untag       `arg:"subcommand:untag" help:"Untag a release"`
+	Gc          *param.Gc          `arg:"subcommand:gc" help:"Prune published versions of a deployment"`
+	OpenApi     *param.OpenApi     `arg:"subcommand:openapi" help:"Export an OpenAPI document of all mounted routes"`
+	Serve       *param.Serve       `arg:"subcommand:serve" help:"Serve every function behind a local api gateway"`
 }
 
 func (c Root) Route(ctx context.Context, api sdk.API) error {
@@ -44,12 +48,24 @@ func (c Root) Route(ctx context.Context, api sdk.API) error {
 	case c.Deployments != nil:
 		return method.ListDeployments(ctx, api, c.Deployments)
 
+	case c.History != nil:
+		return method.ListHistory(ctx, api, c.History)
+
 	case c.Destroy != nil:
 		return method.DestroyDeployment(ctx, api, c.Destroy)
 
 	case c.Untag != nil:
 		return method.UntagRelease(ctx, api, c.Untag)
 
+	case c.Gc != nil:
+		return method.PruneVersions(ctx, api, c.Gc)
+
+	case c.OpenApi != nil:
+		return method.ExportOpenApi(ctx, api, c.OpenApi)
+
+	case c.Serve != nil:
+		return method.ServeFunctions(ctx, api, c.Serve)
+
 	case c.Inspect != nil:
 		switch {
 		case c.Inspect.Build != nil:
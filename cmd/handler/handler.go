@@ -7,9 +7,11 @@ import (
 
 	"github.com/linecard/self/pkg/convention/config"
 	"github.com/linecard/self/pkg/sdk"
+	"github.com/linecard/self/pkg/service/gateway"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/rs/zerolog/log"
@@ -71,8 +73,9 @@ func Handler(ctx context.Context, event config.Event) (err error) {
 
 	stsc := sts.NewFromConfig(awsConfig)
 	ecrc := ecr.NewFromConfig(awsConfig)
+	gws := gateway.FromClients(apigatewayv2.NewFromConfig(awsConfig))
 
-	if cfg, err = config.Stateless(ctx, awsConfig, stsc, ecrc, event); err != nil {
+	if cfg, err = config.Stateless(ctx, awsConfig, stsc, ecrc, gws, event); err != nil {
 		span.SetStatus(codes.Code(codes.Error), "failed to load configuration from event")
 		return
 	}
@@ -94,6 +97,9 @@ func Handler(ctx context.Context, event config.Event) (err error) {
 		return Deploy(ctx, api, event.Detail)
 	case "Destroy":
 		return Destroy(ctx, api, event.Detail)
+	case "Blocked":
+		// Emitted by the scan gate, informational only.
+		return nil
 	default:
 		return fmt.Errorf("unknown event type: %s", event.DetailType)
 	}
@@ -105,6 +111,18 @@ func Deploy(ctx context.Context, api sdk.API, detail config.EventDetail) (err er
 		return fmt.Errorf("failed to find release: %v", err)
 	}
 
+	// Recorded before the gate, so blocked releases show in the history too.
+	record := api.History.Begin(ctx, release)
+	defer func() {
+		if historyErr := api.History.Finish(ctx, record, err); historyErr != nil {
+			log.Warn().Err(historyErr).Msg("failed to record deployment history")
+		}
+	}()
+
+	if err := api.Scan.Gate(ctx, release); err != nil {
+		return fmt.Errorf("failed scan gate: %v", err)
+	}
+
 	deployment, err := api.Deployment.Deploy(ctx, release)
 	if err != nil {
 		return fmt.Errorf("failed to deploy release: %v", err)
@@ -119,6 +137,10 @@ func Deploy(ctx context.Context, api sdk.API, detail config.EventDetail) (err er
 		return fmt.Errorf("failed to converge gateway httproxy: %v", err)
 	}
 
+	if err := api.Permission.Converge(ctx, deployment); err != nil {
+		return fmt.Errorf("failed to converge function permissions: %v", err)
+	}
+
 	return nil
 }
 
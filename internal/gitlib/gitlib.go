@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -18,6 +19,14 @@ type DotGit struct {
 	Root   string
 	Origin *url.URL
 	Dirty  bool
+	Commit Commit
+}
+
+// Commit describes the commit at HEAD.
+type Commit struct {
+	Author  string
+	Subject string
+	Time    time.Time
 }
 
 func FromCwd() (found DotGit, err error) {
@@ -47,6 +56,10 @@ func FromCwd() (found DotGit, err error) {
 		return DotGit{}, err
 	}
 
+	if found.Commit, err = HeadCommit(thisRepo); err != nil {
+		return DotGit{}, err
+	}
+
 	// if found.Path, err = Path(thisRepo); err != nil {
 	// 	return DotGit{}, err
 	// }
@@ -111,6 +124,26 @@ func Sha(repo *git.Repository) (string, error) {
 	return head.Hash().String(), nil
 }
 
+func HeadCommit(repo *git.Repository) (Commit, error) {
+	head, err := Head(repo)
+	if err != nil {
+		return Commit{}, err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return Commit{}, err
+	}
+
+	subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+
+	return Commit{
+		Author:  fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		Subject: strings.TrimSpace(subject),
+		Time:    commit.Committer.When,
+	}, nil
+}
+
 func Dirty(repo *git.Repository) (bool, error) {
 	wt, err := repo.Worktree()
 	if err != nil {
@@ -2,6 +2,7 @@ package account
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/linecard/self/pkg/convention/config"
 	"go.opentelemetry.io/otel"
@@ -45,6 +46,10 @@ func (c Convention) LoginToEcr(ctx context.Context) error {
 		attribute.String("registry-id", c.Config.Registry.Id),
 	)
 
+	if c.Config.Registry.Oci() {
+		return fmt.Errorf("login is only supported for ECR, log in to %s with docker login", c.Config.Registry.Url)
+	}
+
 	token, err := c.Service.Registry.Token(ctx, c.Config.Registry.Id)
 	if err != nil {
 		return err
@@ -20,7 +20,7 @@ type RegistryService interface {
 }
 
 type EventService interface {
-	List(ctx context.Context) ([]event.JoinedRule, error)
+	ListByTarget(ctx context.Context, targetArn string) ([]event.JoinedRule, error)
 	Put(ctx context.Context, bus, rule, expression, function, arn string) error
 	Delete(ctx context.Context, bus, rule, function, arn string) error
 	Emit(ctx context.Context, accountId, busName, detailType string, detail any) error
@@ -43,6 +43,7 @@ type Subscription struct {
 
 type Services struct {
 	Registry RegistryService
+	Package  RegistryService
 	Event    EventService
 }
 
@@ -51,11 +52,12 @@ type Convention struct {
 	Service Services
 }
 
-func FromServices(c config.Config, r RegistryService, e EventService) Convention {
+func FromServices(c config.Config, r, p RegistryService, e EventService) Convention {
 	return Convention{
 		Config: c,
 		Service: Services{
 			Registry: r,
+			Package:  p,
 			Event:    e,
 		},
 	}
@@ -228,7 +230,7 @@ func (c Convention) Converge(ctx context.Context, d deployment.Deployment) error
 func (c Convention) listDefined(ctx context.Context, d deployment.Deployment) ([]Subscription, error) {
 	var subscriptions []Subscription
 
-	release, err := d.FetchRelease(ctx, c.Service.Registry, c.Config.Registry.Id)
+	release, err := d.FetchRelease(ctx, c.Service.Registry, c.Service.Package, c.Config.Registry.Id)
 	if err != nil {
 		return []Subscription{}, err
 	}
@@ -278,15 +280,13 @@ func (c Convention) listDefined(ctx context.Context, d deployment.Deployment) ([
 func (c Convention) listEnabled(ctx context.Context, d deployment.Deployment) ([]Subscription, error) {
 	var activeSubscriptions []Subscription
 
-	subscriptions, err := c.Service.Event.List(ctx)
+	subscriptions, err := c.Service.Event.ListByTarget(ctx, *d.Configuration.FunctionArn)
 	if err != nil {
 		return []Subscription{}, err
 	}
 
 	for _, channel := range subscriptions {
-		if *channel.Target.Arn == *d.Configuration.FunctionArn {
-			activeSubscriptions = append(activeSubscriptions, Subscription{channel, Meta{}})
-		}
+		activeSubscriptions = append(activeSubscriptions, Subscription{channel, Meta{}})
 	}
 
 	return activeSubscriptions, nil
@@ -2,13 +2,18 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/linecard/self/internal/gitlib"
+	"github.com/linecard/self/internal/util"
 	"github.com/linecard/self/pkg/convention/manifest"
+	"github.com/rs/zerolog/log"
 )
 
 type BuildTime struct {
@@ -48,15 +53,89 @@ type ComputedTemplateData struct {
 	RegistryAccountId string
 }
 
+type ComputedRoute struct {
+	RouteKey           string            `json:"routeKey"`
+	AuthType           string            `json:"authType"`
+	AuthorizerId       *string           `json:"authorizerId"`
+	AuthorizerFunction string            `json:"authorizerFunction"`
+	Prefix             string            `json:"prefix"`
+	ForwardedPrefix    string            `json:"forwardedPrefix"`
+	Cors               *ComputedCors     `json:"cors"`
+	Throttle           *ComputedThrottle `json:"throttle"`
+	Preflight          bool              `json:"-"`
+}
+
+type ComputedCors struct {
+	AllowOrigin      string   `json:"allowOrigin"`
+	AllowMethods     []string `json:"allowMethods"`
+	AllowHeaders     []string `json:"allowHeaders"`
+	ExposeHeaders    []string `json:"exposeHeaders"`
+	MaxAge           int32    `json:"maxAge"`
+	AllowCredentials bool     `json:"allowCredentials"`
+	StatusCodes      []int    `json:"statusCodes"`
+}
+
+type ComputedThrottle struct {
+	Burst int32   `json:"burst"`
+	Rate  float64 `json:"rate"`
+}
+
+type ComputedJwt struct {
+	Issuer         string   `json:"issuer"`
+	Audience       []string `json:"audience"`
+	IdentitySource []string `json:"identitySource"`
+}
+
+type ComputedDomain struct {
+	Name           string `json:"name"`
+	BasePath       string `json:"basePath"`
+	CertificateArn string `json:"certificateArn"`
+}
+
+type ComputedAuthorizer struct {
+	Type            string   `json:"type"`
+	IdentitySources []string `json:"identitySources"`
+	Ttl             int32    `json:"ttl"`
+	SimpleResponses *bool    `json:"simpleResponses"`
+}
+
+// ComputedBuild configures the image build. Arg values are templated with TemplateData at build time.
+type ComputedBuild struct {
+	Args    map[string]string `json:"args"`
+	Secrets []ComputedSecret  `json:"secrets"`
+	Ssh     bool              `json:"ssh"`
+	Cache   bool              `json:"cache"`
+}
+
+// ComputedSecret exposes an environment variable or a file to the build as a BuildKit secret.
+type ComputedSecret struct {
+	Id  string `json:"id"`
+	Env string `json:"env"`
+	Src string `json:"src"`
+}
+
 type ComputedResources struct {
-	EphemeralStorage int32    `json:"ephemeralStorage"`
-	MemorySize       int32    `json:"memorySize"`
-	Timeout          int32    `json:"timeout"`
-	Http             bool     `json:"http"`
-	AuthType         string   `json:"authType"`
-	AuthorizerId     *string  `json:"authorizerId"`
-	Audience         []string `json:"audience"`
-	RouteKey         string   `json:"routeKey"`
+	EphemeralStorage   int32               `json:"ephemeralStorage"`
+	MemorySize         int32               `json:"memorySize"`
+	Timeout            int32               `json:"timeout"`
+	Http               bool                `json:"http"`
+	AuthType           string              `json:"authType"`
+	AuthorizerId       *string             `json:"authorizerId"`
+	AuthorizerFunction string              `json:"authorizerFunction"`
+	Authorizer         *ComputedAuthorizer `json:"authorizer"`
+	Jwt                *ComputedJwt        `json:"jwt"`
+	Audience           []string            `json:"audience"` // where Jwt.Audience was declared before, still read for older resources.json
+	Domain             *ComputedDomain     `json:"domain"`
+	Cors               *ComputedCors       `json:"cors"`
+	Throttle           *ComputedThrottle   `json:"throttle"`
+	RouteKey           string              `json:"routeKey"`
+	Routes             []ComputedRoute     `json:"routes"`
+	Build              *ComputedBuild      `json:"build"`
+	Package            string              `json:"package"`
+	Runtime            string              `json:"runtime"`
+	Handler            string              `json:"handler"`
+	// Gatewayed is set when resources.json declares routes, jwt, cors or throttle, which need an api gateway.
+	Gatewayed bool `json:"-"`
 }
 
 type Computed struct {
@@ -72,7 +151,12 @@ func (c Config) ComputeBuildTime(mfst manifest.BuildTime) (BuildTime, error) {
 	buildtime.Computed.Registry.Url = c.Registry.Url
 	buildtime.Computed.Repository.Solve(c.Registry, c.Repository, c.Git, mfst.Name.Decoded)
 	buildtime.Computed.Resource.Solve(c.Account, c.Resource, c.Git, mfst.Name.Decoded)
-	buildtime.Computed.Resources.Solve(c.Repository, c.Git, mfst.Resources.Decoded, mfst.Name.Decoded)
+	if err := buildtime.Computed.Resources.Solve(c.Repository, c.Git, mfst.Resources.Decoded, mfst.Name.Decoded); err != nil {
+		return BuildTime{}, err
+	}
+	if err := buildtime.Computed.Resources.strayAudience(); err != nil {
+		return BuildTime{}, err
+	}
 	buildtime.Computed.TemplateData.Solve(c.Account, c.Registry)
 	return buildtime, nil
 }
@@ -94,11 +178,37 @@ func (c Config) ComputeDeployTime(mfst manifest.DeployTime) (DeployTime, error)
 	deploytime.Computed.Registry.Url = c.Registry.Url
 	deploytime.Computed.Repository.Solve(c.Registry, c.Repository, git, deploytime.Name.Decoded)
 	deploytime.Computed.Resource.Solve(c.Account, c.Resource, git, deploytime.Name.Decoded)
-	deploytime.Computed.Resources.Solve(c.Repository, git, deploytime.Resources.Decoded, deploytime.Name.Decoded)
+	deploytime.Computed.Resource.tagProvenance(deploytime.Release)
+	if err := deploytime.Computed.Resources.Solve(c.Repository, git, deploytime.Resources.Decoded, deploytime.Name.Decoded); err != nil {
+		return DeployTime{}, err
+	}
+	if err := deploytime.Computed.Resources.strayAudience(); err != nil {
+		log.Warn().Err(err).Msgf("ignoring the top-level audience of %s", deploytime.Name.Decoded)
+	}
 	deploytime.Computed.TemplateData.Solve(c.Account, c.Registry)
 	return deploytime, nil
 }
 
+// SolveSibling solves the resource of another function deployed from the same repository and branch,
+// such as an authorizer a route refers to by its bare name.
+func (c Config) SolveSibling(deploytime DeployTime, name string) (ComputedResource, error) {
+	var resource ComputedResource
+
+	origin, err := url.Parse(deploytime.Origin.Decoded)
+	if err != nil {
+		return resource, err
+	}
+
+	git := gitlib.DotGit{
+		Branch: deploytime.Branch.Decoded,
+		Sha:    deploytime.Sha.Decoded,
+		Origin: origin,
+	}
+
+	resource.Solve(c.Account, c.Resource, git, name)
+	return resource, nil
+}
+
 func (r *ComputedRepository) Solve(registry Registry, repository Repository, git gitlib.DotGit, name string) {
 	r.Name = filepath.Clean(repository.Namespace + "/" + name)
 	r.Url = registry.Url + "/" + r.Name
@@ -117,6 +227,36 @@ func (r *ComputedResource) Solve(account Account, resource Resource, git gitlib.
 	}
 }
 
+// tagProvenance copies the release's provenance labels onto the deployment's tags, so deployments describe themselves.
+func (r *ComputedResource) tagProvenance(release manifest.Release) {
+	provenance := map[string]string{
+		"Author":      release.Author.Decoded,
+		"Subject":     release.Subject.Decoded,
+		"Committed":   release.Committed.Decoded,
+		"RunUrl":      release.RunUrl.Decoded,
+		"SelfVersion": release.Version.Decoded,
+	}
+
+	for key, value := range provenance {
+		if value = tagValue(value); value != "" {
+			r.Tags[key] = value
+		}
+	}
+}
+
+// tagValue fits a value to the characters and length AWS allows in tag values.
+func tagValue(value string) string {
+	value = strings.Join(strings.Fields(invalidTagCharacters.ReplaceAllString(value, " ")), " ")
+
+	if runes := []rune(value); len(runes) > 256 {
+		value = strings.TrimSpace(string(runes[:256]))
+	}
+
+	return value
+}
+
+var invalidTagCharacters = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+\-@]`)
+
 func (t *ComputedTemplateData) Solve(account Account, registry Registry) {
 	t.AccountId = account.Id
 	t.Region = account.Region
@@ -124,7 +264,7 @@ func (t *ComputedTemplateData) Solve(account Account, registry Registry) {
 	t.RegistryRegion = registry.Region
 }
 
-func (resources *ComputedResources) Solve(repository Repository, git gitlib.DotGit, resourcesJson, name string) {
+func (resources *ComputedResources) Solve(repository Repository, git gitlib.DotGit, resourcesJson, name string) error {
 	defaults := ComputedResources{
 		EphemeralStorage: 512,
 		MemorySize:       128,
@@ -150,34 +290,316 @@ func (resources *ComputedResources) Solve(repository Repository, git gitlib.DotG
 		defaults.RouteKey = "ANY /" + strings.Join(noOwner, "/") + "/" + git.Branch + "/" + name + "/{proxy+}"
 	}
 
+	if value, exists := os.LookupEnv(EnvDomainName); exists {
+		defaults.Domain = &ComputedDomain{
+			Name:           value,
+			BasePath:       os.Getenv(EnvDomainBasePath),
+			CertificateArn: os.Getenv(EnvDomainCertificateArn),
+		}
+	}
+
 	// Start with the default values
 	*resources = defaults
 
 	if resourcesJson != "" {
 		// Unmarshal into a temporary struct
 		var temp ComputedResources
-		if err := json.Unmarshal([]byte(resourcesJson), &temp); err == nil {
-			// If unmarshaling succeeds, update only the non-zero values
-			if temp.EphemeralStorage != 0 {
-				resources.EphemeralStorage = temp.EphemeralStorage
+		if err := json.Unmarshal([]byte(resourcesJson), &temp); err != nil {
+			return fmt.Errorf("decoding resources.json: %w", err)
+		}
+
+		if temp.EphemeralStorage != 0 {
+			resources.EphemeralStorage = temp.EphemeralStorage
+		}
+		if temp.MemorySize != 0 {
+			resources.MemorySize = temp.MemorySize
+		}
+		if temp.Timeout != 0 {
+			resources.Timeout = temp.Timeout
+		}
+		// For boolean fields, we need to check if they were explicitly set in the JSON
+		if resourcesJson != "" {
+			var jsonMap map[string]interface{}
+			json.Unmarshal([]byte(resourcesJson), &jsonMap)
+			if _, ok := jsonMap["http"]; ok {
+				resources.Http = temp.Http
+			}
+		}
+		if temp.RouteKey != "" {
+			resources.RouteKey = temp.RouteKey
+		}
+		if temp.AuthType != "" {
+			resources.AuthType = temp.AuthType
+			resources.AuthorizerId = temp.AuthorizerId
+		}
+		if temp.AuthorizerId != nil {
+			resources.AuthorizerId = temp.AuthorizerId
+		}
+		if temp.Jwt != nil {
+			resources.Jwt = temp.Jwt
+			if temp.AuthType == "" && temp.AuthorizerId == nil {
+				resources.AuthType = "JWT"
+				resources.AuthorizerId = nil
+			}
+			if len(resources.Jwt.IdentitySource) == 0 {
+				resources.Jwt.IdentitySource = []string{"$request.header.Authorization"}
+			}
+		}
+		if len(temp.Audience) > 0 {
+			resources.Audience = temp.Audience
+			if resources.Jwt != nil && len(resources.Jwt.Audience) == 0 {
+				log.Warn().Msg("top-level \"audience\" in resources.json is deprecated, move it into \"jwt\"")
+				resources.Jwt.Audience = temp.Audience
+			}
+		}
+		if temp.AuthorizerFunction != "" {
+			resources.AuthorizerFunction = temp.AuthorizerFunction
+			if temp.AuthType == "" && temp.AuthorizerId == nil {
+				resources.AuthType = "CUSTOM"
+				resources.AuthorizerId = nil
+			}
+		}
+		if temp.Authorizer != nil {
+			resources.Authorizer = temp.Authorizer
+			if resources.Authorizer.Type == "" {
+				resources.Authorizer.Type = "REQUEST"
+			}
+			if len(resources.Authorizer.IdentitySources) == 0 {
+				resources.Authorizer.IdentitySources = []string{"$request.header.Authorization"}
+			}
+			if resources.Authorizer.SimpleResponses == nil {
+				simple := true
+				resources.Authorizer.SimpleResponses = &simple
+			}
+		}
+		if temp.Domain != nil {
+			if resources.Domain == nil {
+				resources.Domain = &ComputedDomain{}
 			}
-			if temp.MemorySize != 0 {
-				resources.MemorySize = temp.MemorySize
+			if temp.Domain.Name != "" {
+				resources.Domain.Name = temp.Domain.Name
 			}
-			if temp.Timeout != 0 {
-				resources.Timeout = temp.Timeout
+			if temp.Domain.BasePath != "" {
+				resources.Domain.BasePath = temp.Domain.BasePath
 			}
-			// For boolean fields, we need to check if they were explicitly set in the JSON
-			if resourcesJson != "" {
-				var jsonMap map[string]interface{}
-				json.Unmarshal([]byte(resourcesJson), &jsonMap)
-				if _, ok := jsonMap["http"]; ok {
-					resources.Http = temp.Http
-				}
+			if temp.Domain.CertificateArn != "" {
+				resources.Domain.CertificateArn = temp.Domain.CertificateArn
 			}
-			if temp.RouteKey != "" {
-				resources.RouteKey = temp.RouteKey
+		}
+		resources.Cors = temp.Cors
+		resources.Throttle = temp.Throttle
+		resources.Routes = temp.Routes
+		resources.Gatewayed = len(temp.Routes) > 0 || temp.Jwt != nil || temp.Cors != nil || temp.Throttle != nil
+		resources.Build = temp.Build
+		resources.Package = temp.Package
+		resources.Runtime = temp.Runtime
+		resources.Handler = temp.Handler
+	}
+
+	resources.solveDomain(git)
+	return resources.solveRoutes()
+}
+
+// strayAudience reports a top-level audience no jwt takes. Releases published before jwt carried one, which
+// was ignored, so building refuses it while deploying only warns.
+func (resources ComputedResources) strayAudience() error {
+	switch {
+	case len(resources.Audience) == 0:
+		return nil
+	case resources.Jwt == nil:
+		return fmt.Errorf("\"audience\" in resources.json has moved into \"jwt\" along with its issuer, e.g. {\"jwt\": {\"issuer\": \"...\", \"audience\": [...]}}")
+	case !slices.Equal(resources.Jwt.Audience, resources.Audience):
+		return fmt.Errorf("resources.json declares both \"audience\" and \"jwt.audience\", remove the top-level one")
+	default:
+		return nil
+	}
+}
+
+// solvePackage takes the packaging discovered for the function unless resources.json declares one,
+// and defaults the runtime and handler of zips from the handler file found.
+func (resources *ComputedResources) solvePackage(selfish Selfish) {
+	var runtime, handler string
+
+	if resources.Package == "" {
+		resources.Package = selfish.Package
+	}
+
+	if resources.Package != "zip" {
+		return
+	}
+
+	for _, file := range ZipHandlers {
+		if _, err := os.Stat(filepath.Join(selfish.Path, file)); err != nil {
+			continue
+		}
+
+		switch filepath.Ext(file) {
+		case ".py":
+			runtime = "python3.12"
+			handler = strings.TrimSuffix(file, ".py") + ".handler"
+			if file == "lambda_function.py" {
+				handler = "lambda_function.lambda_handler"
+			}
+		default:
+			runtime = "nodejs20.x"
+			handler = "index.handler"
+		}
+		break
+	}
+
+	if resources.Runtime == "" {
+		resources.Runtime = runtime
+	}
+
+	if resources.Handler == "" {
+		resources.Handler = handler
+	}
+}
+
+// The domain name may carry a {branch} placeholder, e.g. "{branch}.preview.example.com".
+func (resources *ComputedResources) solveDomain(git gitlib.DotGit) {
+	if resources.Domain == nil {
+		return
+	}
+
+	if resources.Domain.Name == "" {
+		log.Warn().Msg("ignoring domain without a name")
+		resources.Domain = nil
+		return
+	}
+
+	resources.Domain.Name = strings.ReplaceAll(resources.Domain.Name, "{branch}", util.DeSlasher(git.Branch))
+	resources.Domain.BasePath = strings.Trim(resources.Domain.BasePath, "/")
+}
+
+// Routes declared in resources.json are relative to the function's prefix, e.g. "GET /health".
+// Without any declared routes, the function is mounted on its single proxy route key.
+func (resources *ComputedResources) solveRoutes() error {
+	prefix := strings.TrimSuffix(routePath(resources.RouteKey), "/{proxy+}")
+	forwardedPrefix := prefix
+	if resources.Domain != nil && resources.Domain.BasePath != "" {
+		forwardedPrefix = "/" + resources.Domain.BasePath + prefix
+	}
+
+	declared := resources.Routes
+	resources.Routes = []ComputedRoute{}
+
+	if len(declared) == 0 {
+		resources.Routes = append(resources.Routes, ComputedRoute{
+			RouteKey:           resources.RouteKey,
+			AuthType:           resources.AuthType,
+			AuthorizerId:       resources.AuthorizerId,
+			AuthorizerFunction: resources.AuthorizerFunction,
+			Prefix:             prefix,
+			ForwardedPrefix:    forwardedPrefix,
+			Cors:               resources.Cors,
+			Throttle:           resources.Throttle,
+		})
+		return resources.solvePreflights()
+	}
+
+	for _, route := range declared {
+		method, path, found := strings.Cut(route.RouteKey, " ")
+		if !found || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid route %q in resources.json, expected form \"METHOD /path\"", route.RouteKey)
+		}
+
+		if path == "/" {
+			path = ""
+		}
+
+		switch {
+		case route.AuthType == "" && route.AuthorizerFunction != "":
+			route.AuthType = "CUSTOM"
+		case route.AuthType == "":
+			route.AuthType = resources.AuthType
+			if route.AuthorizerId == nil {
+				route.AuthorizerId = resources.AuthorizerId
+				route.AuthorizerFunction = resources.AuthorizerFunction
 			}
 		}
+
+		route.RouteKey = strings.ToUpper(method) + " " + prefix + path
+		route.Prefix = prefix
+		route.ForwardedPrefix = forwardedPrefix
+
+		if route.Cors == nil {
+			route.Cors = resources.Cors
+		}
+
+		if route.Throttle == nil {
+			route.Throttle = resources.Throttle
+		}
+
+		resources.Routes = append(resources.Routes, route)
+	}
+
+	return resources.solvePreflights()
+}
+
+// solvePreflights adds an unauthenticated OPTIONS route for each path whose routes declare CORS, so
+// browsers' preflight requests are answered even where the routes themselves require authorization.
+// Methods allowed by the preflight default to those routed on the path.
+func (resources *ComputedResources) solvePreflights() error {
+	var paths []string
+	methods := map[string][]string{}
+	cors := map[string]*ComputedCors{}
+	declared := map[string]bool{}
+
+	for _, route := range resources.Routes {
+		declared[route.RouteKey] = true
+
+		if route.Cors == nil {
+			continue
+		}
+
+		if route.Cors.AllowCredentials && (route.Cors.AllowOrigin == "" || route.Cors.AllowOrigin == "*") {
+			return fmt.Errorf("cors of route %s allows credentials, which browsers refuse for any origin, set allowOrigin", route.RouteKey)
+		}
+
+		method, path, found := strings.Cut(route.RouteKey, " ")
+		if !found || method == "OPTIONS" {
+			continue
+		}
+
+		if _, found := cors[path]; !found {
+			paths = append(paths, path)
+			cors[path] = route.Cors
+		}
+
+		if method == "ANY" {
+			method = "GET,POST,PUT,PATCH,DELETE,HEAD"
+		}
+		methods[path] = append(methods[path], method)
+	}
+
+	for _, path := range paths {
+		routeKey := "OPTIONS " + path
+		if declared[routeKey] {
+			continue
+		}
+
+		preflight := *cors[path]
+		if len(preflight.AllowMethods) == 0 {
+			preflight.AllowMethods = methods[path]
+		}
+
+		resources.Routes = append(resources.Routes, ComputedRoute{
+			RouteKey:        routeKey,
+			AuthType:        "NONE",
+			Prefix:          resources.Routes[0].Prefix,
+			ForwardedPrefix: resources.Routes[0].ForwardedPrefix,
+			Cors:            &preflight,
+			Preflight:       true,
+		})
+	}
+
+	return nil
+}
+
+func routePath(routeKey string) string {
+	if _, path, found := strings.Cut(routeKey, " "); found {
+		return path
 	}
+	return routeKey
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
 	"github.com/linecard/self/internal/gitlib"
 	"github.com/linecard/self/internal/util"
 	"github.com/linecard/self/pkg/convention/manifest"
@@ -21,14 +22,43 @@ const (
 	EnvOwnerPrefixRoutes    = "SELF_PREFIX_ROUTE_KEY_WITH_OWNER"
 	EnvEcrId                = "SELF_ECR_REGISTRY_ID"
 	EnvEcrRegion            = "SELF_ECR_REGISTRY_REGION"
+	EnvRegistryUrl          = "SELF_REGISTRY_URL"
+	EnvRegistryUsername     = "SELF_REGISTRY_USERNAME"
+	EnvRegistryPassword     = "SELF_REGISTRY_PASSWORD"
 	EnvGwId                 = "SELF_API_GATEWAY_ID"
+	EnvGwDiscoveryName      = "SELF_API_GATEWAY_DISCOVERY_NAME"
 	EnvAuthType             = "SELF_API_GATEWAY_AUTH_TYPE"
 	EnvAuthorizerId         = "SELF_API_GATEWAY_AUTHORIZER_ID"
+	EnvGwStage              = "SELF_API_GATEWAY_STAGE"
+	EnvDomainName           = "SELF_API_GATEWAY_DOMAIN_NAME"
+	EnvDomainBasePath       = "SELF_API_GATEWAY_DOMAIN_BASE_PATH"
+	EnvDomainCertificateArn = "SELF_API_GATEWAY_DOMAIN_CERTIFICATE_ARN"
 	EnvSgIds                = "SELF_SECURITY_GROUP_IDS"
 	EnvSnIds                = "SELF_SUBNET_IDS"
 	EnvBusName              = "SELF_SELF_BUS_NAME"
+	EnvHistoryTable         = "SELF_HISTORY_TABLE"
+	EnvHistoryPath          = "SELF_HISTORY_PATH"
+	EnvHistoryBucket        = "SELF_HISTORY_BUCKET"
+	EnvKeepVersions         = "SELF_KEEP_VERSIONS"
+	EnvDiskCache            = "SELF_DISK_CACHE"
+	EnvBuilder              = "SELF_BUILDER"
+	EnvBuildPlatform        = "SELF_BUILD_PLATFORM"
+	EnvArchitecture         = "SELF_ARCHITECTURE"
+	EnvBuildkitHost         = "SELF_BUILDKIT_HOST"
+	EnvCompressLabels       = "SELF_COMPRESS_LABELS"
+	EnvPackageBucket        = "SELF_PACKAGE_BUCKET"
+	EnvScanSeverity         = "SELF_SCAN_SEVERITY"
+	EnvScanAllowlist        = "SELF_SCAN_ALLOWLIST"
+	EnvPullAccounts         = "SELF_ECR_PULL_ACCOUNTS"
+	EnvExpireUntaggedDays   = "SELF_ECR_EXPIRE_UNTAGGED_DAYS"
+	EnvImmutableShaTags     = "SELF_ECR_IMMUTABLE_SHA_TAGS"
+	EnvCiRunUrl             = "SELF_CI_RUN_URL"
+	EnvSigningKey           = "SELF_SIGNING_KEY"
+	EnvTrustedKeys          = "SELF_TRUSTED_KEYS"
 )
 
+const TagDiscovery = "SelfDiscovery"
+
 //go:embed embedded/*
 var embedded embed.FS
 
@@ -54,10 +84,23 @@ type Registry struct {
 	Id     string
 	Region string
 	Url    string
+	// Endpoint is the base url of a registry speaking the OCI distribution API, empty for ECR.
+	Endpoint string
+	// Username and Password authenticate with the OCI registry, ECR uses the caller's credentials.
+	Username string
+	Password string
+	// Architecture is the image read from multi-platform releases, e.g. arm64.
+	Architecture string
+}
+
+func (r Registry) Oci() bool {
+	return r.Endpoint != ""
 }
 
 type ApiGateway struct {
-	Id *string
+	Id            *string
+	DiscoveryName string
+	Stage         string
 }
 
 type Vpc struct {
@@ -84,9 +127,77 @@ type Bus struct {
 	Name *string
 }
 
+type History struct {
+	Table  *string
+	Bucket *string
+	Path   *string
+}
+
+type Versions struct {
+	Keep int
+}
+
+type Cache struct {
+	Dir *string
+}
+
+// Builder selects how images are built: docker, buildx, podman or buildkit.
+// Buildkit builds to an OCI archive which is pushed without a daemon, the others load a local image.
+type Builder struct {
+	Backend  string
+	Platform string
+	Host     string
+	// CompressLabels gzips large labels. Such releases are schema 1.2, which older deployers refuse.
+	CompressLabels bool
+}
+
+// Archives is true when builds write an OCI archive rather than a local image. Buildkit always does,
+// buildx does for multi-platform builds, which the docker image store cannot load.
+func (b Builder) Archives() bool {
+	return b.Backend == "buildkit" || b.MultiPlatform()
+}
+
+func (b Builder) MultiPlatform() bool {
+	return strings.Contains(b.Platform, ",")
+}
+
+// Packages is where zip packaged functions are published, they need no registry.
+type Packages struct {
+	Bucket string
+}
+
+// Scan blocks releases with findings at or above Severity, unless Allowlist accepts them. An empty severity disables it.
+type Scan struct {
+	Severity  string
+	Allowlist []string
+}
+
+// Repositories are the settings reconciled onto every function repository when it is ensured.
+// PullAccounts may pull its images into Lambda, untagged images expire after ExpireUntaggedDays,
+// and ImmutableShaTags refuses to publish over an existing sha tag. Zero values leave each unmanaged.
+type Repositories struct {
+	PullAccounts       []string
+	ExpireUntaggedDays int
+	ImmutableShaTags   bool
+}
+
+// Signing signs releases as they are published with Key, and refuses to deploy releases
+// not signed by one of the Trusted keys. An empty trust policy deploys any release.
+type Signing struct {
+	Key     string
+	Trusted []string
+}
+
+// Ci is the continuous integration run building releases, if any.
+type Ci struct {
+	RunUrl string
+}
+
 type Selfish struct {
 	Path string
 	Name string
+	// Package is "image" for functions with a Dockerfile, "zip" for bare handlers.
+	Package string
 }
 
 type Config struct {
@@ -94,6 +205,15 @@ type Config struct {
 	Caller       Caller
 	Account      Account
 	Bus          Bus
+	History      History
+	Versions     Versions
+	Cache        Cache
+	Builder      Builder
+	Packages     Packages
+	Scan         Scan
+	Repositories Repositories
+	Ci           Ci
+	Signing      Signing
 	Git          gitlib.DotGit
 	Registry     Registry
 	Repository   Repository
@@ -106,8 +226,8 @@ type Config struct {
 }
 
 // Initialize configuration from AWS and local filesystem.
-func Stateful(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc ECRClient) (c Config, err error) {
-	if err = c.FromAws(ctx, awsConfig, stsc, ecrc); err != nil {
+func Stateful(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc ECRClient, gws GatewayService) (c Config, err error) {
+	if err = c.FromAws(ctx, awsConfig, stsc, ecrc, gws); err != nil {
 		return
 	}
 
@@ -138,8 +258,8 @@ func Stateful(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc EC
 }
 
 // Initialize configuration from AWS only.
-func Stateless(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc ECRClient, event Event) (c Config, err error) {
-	if err = c.FromAws(ctx, awsConfig, stsc, ecrc); err != nil {
+func Stateless(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc ECRClient, gws GatewayService, event Event) (c Config, err error) {
+	if err = c.FromAws(ctx, awsConfig, stsc, ecrc, gws); err != nil {
 		return
 	}
 
@@ -167,6 +287,26 @@ func Stateless(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc E
 	return
 }
 
+// ForAccount copies the configuration for deploying into another account, rediscovering only what differs
+// there: the caller, the account and its API gateway. The registry, git state and functions are shared.
+func (c Config) ForAccount(ctx context.Context, awsConfig aws.Config, stsc STSClient, gws GatewayService) (Config, error) {
+	c.AwsConfig = awsConfig
+	c.ApiGateway = ApiGateway{}
+
+	if err := c.discoverCaller(ctx, stsc, awsConfig); err != nil {
+		return Config{}, err
+	}
+
+	if err := c.discoverGateway(ctx, gws); err != nil {
+		return Config{}, err
+	}
+
+	c.TemplateData.AccountId = c.Account.Id
+	c.TemplateData.Region = c.Account.Region
+
+	return c, nil
+}
+
 // Generate buildtime configuration from a selfish path.
 func (c Config) BuildTime(buildPath string) (BuildTime, error) {
 	absPath, err := filepath.Abs(buildPath)
@@ -176,11 +316,23 @@ func (c Config) BuildTime(buildPath string) (BuildTime, error) {
 
 	for _, s := range c.Selfish {
 		if s.Path == absPath {
-			buildtime, err := manifest.Encode(absPath, c.Git)
+			buildtime, err := manifest.Encode(absPath, c.Git, manifest.Provenance{
+				RunUrl:  c.Ci.RunUrl,
+				Version: c.Version,
+			}, manifest.Options{
+				Compress: c.Builder.CompressLabels,
+			})
 			if err != nil {
 				return BuildTime{}, err
 			}
-			return c.ComputeBuildTime(buildtime)
+
+			computed, err := c.ComputeBuildTime(buildtime)
+			if err != nil {
+				return BuildTime{}, fmt.Errorf("%s: %w", filepath.Join(absPath, "resources.json.tmpl"), err)
+			}
+
+			computed.Computed.Resources.solvePackage(s)
+			return computed, nil
 		}
 	}
 
@@ -196,3 +348,22 @@ func (c Config) DeployTime(labels map[string]string) (DeployTime, error) {
 
 	return c.ComputeDeployTime(deploytime)
 }
+
+// Discoverable reports whether the api carries the SelfDiscovery tag, matching the discovery name if one is configured.
+func (g ApiGateway) Discoverable(api types.Api) bool {
+	name, tagged := api.Tags[TagDiscovery]
+	if !tagged {
+		return false
+	}
+
+	return g.DiscoveryName == "" || g.DiscoveryName == name
+}
+
+// Manages reports whether self may modify the api, being either the configured gateway or a discoverable one.
+func (g ApiGateway) Manages(api types.Api) bool {
+	if g.Id != nil && *g.Id == aws.ToString(api.ApiId) {
+		return true
+	}
+
+	return g.Discoverable(api)
+}
@@ -6,12 +6,19 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/linecard/self/internal/gitlib"
+	"github.com/rs/zerolog/log"
 )
 
 type STSClient interface {
@@ -23,7 +30,13 @@ type ECRClient interface {
 	DescribeRegistry(ctx context.Context, params *ecr.DescribeRegistryInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRegistryOutput, error)
 }
 
-func (c *Config) FromAws(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc ECRClient) (err error) {
+type GatewayService interface {
+	GetApis(ctx context.Context) (*apigatewayv2.GetApisOutput, error)
+}
+
+func (c *Config) FromAws(ctx context.Context, awsConfig aws.Config, stsc STSClient, ecrc ECRClient, gws GatewayService) (err error) {
+	c.AwsConfig = awsConfig
+
 	if err = c.discoverCaller(ctx, stsc, awsConfig); err != nil {
 		return
 	}
@@ -32,7 +45,7 @@ func (c *Config) FromAws(ctx context.Context, awsConfig aws.Config, stsc STSClie
 		return
 	}
 
-	if err = c.discoverGateway(); err != nil {
+	if err = c.discoverGateway(ctx, gws); err != nil {
 		return
 	}
 
@@ -44,6 +57,34 @@ func (c *Config) FromAws(ctx context.Context, awsConfig aws.Config, stsc STSClie
 		return
 	}
 
+	if err = c.discoverHistory(); err != nil {
+		return
+	}
+
+	if err = c.discoverVersions(); err != nil {
+		return
+	}
+
+	if err = c.discoverCache(); err != nil {
+		return
+	}
+
+	if err = c.discoverPackages(); err != nil {
+		return
+	}
+
+	if err = c.discoverScan(); err != nil {
+		return
+	}
+
+	if err = c.discoverRepositories(); err != nil {
+		return
+	}
+
+	if err = c.discoverSigning(); err != nil {
+		return
+	}
+
 	return nil
 }
 
@@ -66,6 +107,18 @@ func (c *Config) FromCwd(ctx context.Context) (err error) {
 		return
 	}
 
+	if err = c.discoverBuilder(); err != nil {
+		return
+	}
+
+	if err = c.discoverCi(); err != nil {
+		return
+	}
+
+	if err = c.discoverVersion(); err != nil {
+		return
+	}
+
 	return nil
 }
 
@@ -93,6 +146,14 @@ func (c *Config) discoverRegistry(ctx context.Context, ecrFallback ECRClient, re
 		c.Registry.Region = regionFallback.Region
 	}
 
+	if err = c.discoverArchitecture(); err != nil {
+		return err
+	}
+
+	if registryUrl, exists := os.LookupEnv(EnvRegistryUrl); exists {
+		return c.discoverOciRegistry(registryUrl)
+	}
+
 	if id, exists := os.LookupEnv(EnvEcrId); exists {
 		c.Registry.Id = id
 	} else {
@@ -108,13 +169,147 @@ func (c *Config) discoverRegistry(ctx context.Context, ecrFallback ECRClient, re
 	return nil
 }
 
-func (c *Config) discoverGateway() (err error) {
-	if gwId, exists := os.LookupEnv(EnvGwId); exists {
+// discoverArchitecture picks the image deployed from multi-platform releases. Lambda runs one architecture per
+// function, so it defaults to the first platform built, and to the index's first linux image when neither is set.
+func (c *Config) discoverArchitecture() error {
+	architecture, exists := os.LookupEnv(EnvArchitecture)
+	if !exists {
+		platform, _, _ := strings.Cut(os.Getenv(EnvBuildPlatform), ",")
+		_, architecture, _ = strings.Cut(platform, "/")
+		architecture, _, _ = strings.Cut(architecture, "/")
+	}
+
+	switch architecture {
+	case "", "amd64", "arm64":
+	default:
+		return fmt.Errorf("%s must be amd64 or arm64, the architectures Lambda runs, got %q", EnvArchitecture, architecture)
+	}
+
+	c.Registry.Architecture = architecture
+	return nil
+}
+
+// An OCI registry is given as host[:port], optionally with a scheme. Without one, https is
+// assumed except for localhost. The registry id falls back to the caller's account.
+func (c *Config) discoverOciRegistry(registryUrl string) (err error) {
+	scheme := "https"
+	host := registryUrl
+
+	if before, after, found := strings.Cut(registryUrl, "://"); found {
+		scheme, host = before, after
+	} else if strings.HasPrefix(host, "localhost") || strings.HasPrefix(host, "127.0.0.1") {
+		scheme = "http"
+	}
+
+	host = strings.TrimSuffix(host, "/")
+	if host == "" || strings.Contains(host, "/") {
+		return fmt.Errorf("%s must be a registry host, got %q", EnvRegistryUrl, registryUrl)
+	}
+
+	c.Registry.Url = host
+	c.Registry.Endpoint = scheme + "://" + host
+	c.Registry.Username = os.Getenv(EnvRegistryUsername)
+	c.Registry.Password = os.Getenv(EnvRegistryPassword)
+
+	if (c.Registry.Username == "") != (c.Registry.Password == "") {
+		return fmt.Errorf("either both or none of %s and %s must be set", EnvRegistryUsername, EnvRegistryPassword)
+	}
+
+	c.Registry.Id = c.Account.Id
+	if id, exists := os.LookupEnv(EnvEcrId); exists {
+		c.Registry.Id = id
+	}
+
+	return nil
+}
+
+// The gateway is discovered by its SelfDiscovery tag, SELF_API_GATEWAY_ID is the fallback when none is tagged,
+// and chooses between several tagged ones. Finding no gateway is left to the deployment to fail on, only
+// functions that declare routes need one.
+func (c *Config) discoverGateway(ctx context.Context, gws GatewayService) (err error) {
+	c.ApiGateway.Stage = "$default"
+	if stage, exists := os.LookupEnv(EnvGwStage); exists {
+		c.ApiGateway.Stage = stage
+	}
+
+	if name, exists := os.LookupEnv(EnvGwDiscoveryName); exists {
+		c.ApiGateway.DiscoveryName = name
+	}
+
+	matches, err := c.discoverableGateways(ctx, gws)
+	if err != nil {
+		return err
+	}
+
+	gwId, gwIdExists := os.LookupEnv(EnvGwId)
+
+	switch {
+	case len(matches) == 1:
+		if gwIdExists && gwId != matches[0] {
+			log.Warn().Msgf("ignoring %s=%s, api gateway %s is tagged %s", EnvGwId, gwId, matches[0], TagDiscovery)
+		}
+		c.ApiGateway.Id = &matches[0]
+	case len(matches) > 1:
+		if gwIdExists && slices.Contains(matches, gwId) {
+			c.ApiGateway.Id = &gwId
+			return nil
+		}
+		return fmt.Errorf("found %d api gateways tagged %s (%s), set %s to choose one", len(matches), TagDiscovery, strings.Join(matches, ", "), EnvGwId)
+	case gwIdExists:
 		c.ApiGateway.Id = &gwId
+	case c.ApiGateway.DiscoveryName != "":
+		return fmt.Errorf("no api gateway tagged %s: %s, set %s or tag the gateway", TagDiscovery, c.ApiGateway.DiscoveryName, EnvGwId)
 	}
+
 	return nil
 }
 
+// gatewayCacheTTL bounds how long a warm deployer trusts the gateways it discovered, so one tagged
+// later is still picked up without listing every api on each event.
+const gatewayCacheTTL = 5 * time.Minute
+
+type gatewayCacheEntry struct {
+	matches []string
+	expires time.Time
+}
+
+var gatewayCache = struct {
+	sync.Mutex
+	entries map[string]gatewayCacheEntry
+}{entries: map[string]gatewayCacheEntry{}}
+
+// discoverableGateways lists the ids of the apis carrying the SelfDiscovery tag, cached per account,
+// region and discovery name.
+func (c *Config) discoverableGateways(ctx context.Context, gws GatewayService) ([]string, error) {
+	key := strings.Join([]string{c.Account.Id, c.Account.Region, c.ApiGateway.DiscoveryName}, "/")
+
+	gatewayCache.Lock()
+	defer gatewayCache.Unlock()
+
+	if entry, found := gatewayCache.entries[key]; found && time.Now().Before(entry.expires) {
+		return slices.Clone(entry.matches), nil
+	}
+
+	apis, err := gws.GetApis(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, api := range apis.Items {
+		if c.ApiGateway.Discoverable(api) {
+			matches = append(matches, *api.ApiId)
+		}
+	}
+
+	gatewayCache.entries[key] = gatewayCacheEntry{
+		matches: matches,
+		expires: time.Now().Add(gatewayCacheTTL),
+	}
+
+	return slices.Clone(matches), nil
+}
+
 func (c *Config) discoverVpc() (err error) {
 	var count int
 
@@ -144,6 +339,155 @@ func (c *Config) discoverBus() (err error) {
 	return nil
 }
 
+func (c *Config) discoverHistory() (err error) {
+	if table, exists := os.LookupEnv(EnvHistoryTable); exists {
+		c.History.Table = &table
+	}
+
+	if bucket, exists := os.LookupEnv(EnvHistoryBucket); exists {
+		bucket = strings.TrimPrefix(bucket, "s3://")
+		c.History.Bucket = &bucket
+	}
+
+	if path, exists := os.LookupEnv(EnvHistoryPath); exists {
+		c.History.Path = &path
+	}
+
+	return nil
+}
+
+func (c *Config) discoverVersions() (err error) {
+	c.Versions.Keep = 10
+
+	if keep, exists := os.LookupEnv(EnvKeepVersions); exists {
+		if c.Versions.Keep, err = strconv.Atoi(keep); err != nil || c.Versions.Keep < 0 {
+			return fmt.Errorf("%s must be a non-negative integer, got %q", EnvKeepVersions, keep)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) discoverPackages() (err error) {
+	if bucket, exists := os.LookupEnv(EnvPackageBucket); exists {
+		c.Packages.Bucket = strings.TrimPrefix(bucket, "s3://")
+	}
+	return nil
+}
+
+func (c *Config) discoverScan() (err error) {
+	severity, exists := os.LookupEnv(EnvScanSeverity)
+	if !exists || severity == "" {
+		return nil
+	}
+
+	c.Scan.Severity = strings.ToUpper(severity)
+
+	for _, id := range strings.Split(os.Getenv(EnvScanAllowlist), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			c.Scan.Allowlist = append(c.Scan.Allowlist, id)
+		}
+	}
+
+	switch c.Scan.Severity {
+	case "CRITICAL", "HIGH", "MEDIUM", "LOW", "INFORMATIONAL":
+		return nil
+	default:
+		return fmt.Errorf("%s must be one of CRITICAL, HIGH, MEDIUM, LOW or INFORMATIONAL, got %q", EnvScanSeverity, severity)
+	}
+}
+
+func (c *Config) discoverRepositories() (err error) {
+	if accounts, exists := os.LookupEnv(EnvPullAccounts); exists {
+		for _, account := range strings.Split(accounts, ",") {
+			if account = strings.TrimSpace(account); account != "" {
+				c.Repositories.PullAccounts = append(c.Repositories.PullAccounts, account)
+			}
+		}
+	}
+
+	if days, exists := os.LookupEnv(EnvExpireUntaggedDays); exists {
+		if c.Repositories.ExpireUntaggedDays, err = strconv.Atoi(days); err != nil || c.Repositories.ExpireUntaggedDays < 0 {
+			return fmt.Errorf("%s must be a non-negative integer, got %q", EnvExpireUntaggedDays, days)
+		}
+	}
+
+	if value, exists := os.LookupEnv(EnvImmutableShaTags); exists {
+		c.Repositories.ImmutableShaTags = strings.ToLower(value) == "true"
+	}
+
+	return nil
+}
+
+func (c *Config) discoverSigning() (err error) {
+	if key, exists := os.LookupEnv(EnvSigningKey); exists {
+		c.Signing.Key = key
+	}
+
+	if keys, exists := os.LookupEnv(EnvTrustedKeys); exists {
+		for _, key := range strings.Split(keys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				c.Signing.Trusted = append(c.Signing.Trusted, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// discoverCache enables the on-disk release cache. "true" places it under the user cache dir,
+// any other value but "false" is taken as the directory to use.
+func (c *Config) discoverCache() (err error) {
+	value, exists := os.LookupEnv(EnvDiskCache)
+	if !exists || value == "" || strings.ToLower(value) == "false" {
+		return nil
+	}
+
+	dir := value
+	if strings.ToLower(value) == "true" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("%s: %w", EnvDiskCache, err)
+		}
+		dir = filepath.Join(userCacheDir, "self", "releases")
+	}
+
+	c.Cache.Dir = &dir
+	return nil
+}
+
+func (c *Config) discoverBuilder() (err error) {
+	c.Builder.Backend = "docker"
+	if backend, exists := os.LookupEnv(EnvBuilder); exists && backend != "" {
+		c.Builder.Backend = backend
+	}
+
+	switch c.Builder.Backend {
+	case "docker", "buildx", "podman", "buildkit":
+	default:
+		return fmt.Errorf("%s must be one of docker, buildx, podman or buildkit, got %q", EnvBuilder, c.Builder.Backend)
+	}
+
+	if platform, exists := os.LookupEnv(EnvBuildPlatform); exists {
+		c.Builder.Platform = platform
+	}
+
+	// Only buildx builds several platforms at once, releases then deploy the image of the configured architecture.
+	if c.Builder.MultiPlatform() && c.Builder.Backend != "buildx" {
+		return fmt.Errorf("%s names several platforms, which only the buildx builder builds, got %q", EnvBuildPlatform, c.Builder.Platform)
+	}
+
+	if host, exists := os.LookupEnv(EnvBuildkitHost); exists {
+		c.Builder.Host = host
+	}
+
+	if value, exists := os.LookupEnv(EnvCompressLabels); exists {
+		c.Builder.CompressLabels = strings.ToLower(value) == "true"
+	}
+
+	return nil
+}
+
 func (c *Config) discoverGit() (err error) {
 	if c.Git, err = gitlib.FromCwd(); err != nil {
 		return err
@@ -153,25 +497,91 @@ func (c *Config) discoverGit() (err error) {
 		c.Git.Branch = value
 	}
 
-	if value, exists := os.LookupEnv(EnvGitSha); exists {
+	if value, exists := os.LookupEnv(EnvGitSha); exists && value != c.Git.Sha {
+		// HEAD's commit says nothing of another sha.
 		c.Git.Sha = value
+		c.Git.Commit = gitlib.Commit{}
 	}
 
 	return err
 }
 
+// discoverCi finds the url of the CI run building releases, from SELF_CI_RUN_URL or the variables common CI providers set.
+func (c *Config) discoverCi() (err error) {
+	env := os.Getenv
+
+	switch {
+	case env(EnvCiRunUrl) != "":
+		c.Ci.RunUrl = env(EnvCiRunUrl)
+	case env("GITHUB_RUN_ID") != "":
+		c.Ci.RunUrl = fmt.Sprintf("%s/%s/actions/runs/%s", env("GITHUB_SERVER_URL"), env("GITHUB_REPOSITORY"), env("GITHUB_RUN_ID"))
+	case env("CI_JOB_URL") != "":
+		c.Ci.RunUrl = env("CI_JOB_URL")
+	case env("CIRCLE_BUILD_URL") != "":
+		c.Ci.RunUrl = env("CIRCLE_BUILD_URL")
+	case env("BUILDKITE_BUILD_URL") != "":
+		c.Ci.RunUrl = env("BUILDKITE_BUILD_URL")
+	case env("BUILD_BUILDID") != "" && env("SYSTEM_COLLECTIONURI") != "":
+		c.Ci.RunUrl = fmt.Sprintf("%s%s/_build/results?buildId=%s", env("SYSTEM_COLLECTIONURI"), env("SYSTEM_TEAMPROJECT"), env("BUILD_BUILDID"))
+	case env("BITBUCKET_BUILD_NUMBER") != "" && env("BITBUCKET_GIT_HTTP_ORIGIN") != "":
+		c.Ci.RunUrl = fmt.Sprintf("%s/pipelines/results/%s", env("BITBUCKET_GIT_HTTP_ORIGIN"), env("BITBUCKET_BUILD_NUMBER"))
+	case env("BUILD_URL") != "":
+		// Jenkins, and others following its lead.
+		c.Ci.RunUrl = env("BUILD_URL")
+	}
+
+	return nil
+}
+
+// discoverVersion reads self's own version from its build info, the module version when installed
+// with go install, otherwise the revision it was built from.
+func (c *Config) discoverVersion() (err error) {
+	c.Version = "devel"
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		c.Version = info.Main.Version
+		return nil
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			c.Version = "devel-" + setting.Value[:12]
+		}
+	}
+
+	return nil
+}
+
+// ZipHandlers mark a function without a Dockerfile as zip packaged, in order of precedence.
+var ZipHandlers = []string{"package.json", "index.mjs", "index.js", "lambda_function.py", "handler.py"}
+
 func (c *Config) discoverSelfish() (err error) {
-	selfish := func(path string) bool {
-		signature := []string{"policy.json.tmpl", "Dockerfile"}
+	exists := func(path, item string) bool {
+		_, err := os.Stat(filepath.Join(path, item))
+		return err == nil
+	}
 
-		for _, item := range signature {
-			fullPath := fmt.Sprintf("%s/%s", path, item)
-			if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-				return false
+	packaging := func(path string) string {
+		if !exists(path, "policy.json.tmpl") {
+			return ""
+		}
+
+		if exists(path, "Dockerfile") {
+			return "image"
+		}
+
+		for _, handler := range ZipHandlers {
+			if exists(path, handler) {
+				return "zip"
 			}
 		}
 
-		return true
+		return ""
 	}
 
 	filepath.Walk(c.Git.Root, func(path string, info os.FileInfo, err error) error {
@@ -180,15 +590,20 @@ func (c *Config) discoverSelfish() (err error) {
 		}
 
 		selfRepoEmbedded := "self/pkg/convention/config/embedded/scaffold/"
-		if info.IsDir() && selfish(path) && !strings.Contains(path, selfRepoEmbedded) {
+		if !info.IsDir() || strings.Contains(path, selfRepoEmbedded) {
+			return nil
+		}
+
+		if pkg := packaging(path); pkg != "" {
 			abs, err := filepath.Abs(path)
 			if err != nil {
 				return err
 			}
 
 			c.Selfish = append(c.Selfish, Selfish{
-				Path: abs,
-				Name: filepath.Base(abs),
+				Path:    abs,
+				Name:    filepath.Base(abs),
+				Package: pkg,
 			})
 		}
 
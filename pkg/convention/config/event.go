@@ -16,4 +16,6 @@ type EventDetail struct {
 	RepositoryName string   `json:"repository-name"`
 	ResourceName   string   `json:"resource-name"`
 	ExceptAccounts []string `json:"except-accounts"`
+	Reason         string   `json:"reason,omitempty"`
+	Findings       []string `json:"findings,omitempty"`
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsc "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/aws/aws-sdk-go-v2/service/sts/types"
 	"github.com/rs/zerolog/log"
@@ -65,3 +66,15 @@ func (c Config) AssumeRoleWithPolicy(ctx context.Context, policy string) (*types
 		SessionToken:    &fallback.SessionToken,
 	}, nil
 }
+
+// Derive an AWS configuration which acts as the given role in the given account.
+func AssumeAccountRole(awsConfig aws.Config, accountId, roleName string) aws.Config {
+	roleArn := util.RoleArnFromName(accountId, roleName)
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsConfig), roleArn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = "self-deploy-" + accountId
+	})
+
+	assumed := awsConfig.Copy()
+	assumed.Credentials = aws.NewCredentialsCache(provider)
+	return assumed
+}
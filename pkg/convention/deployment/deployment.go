@@ -2,11 +2,17 @@ package deployment
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/linecard/self/internal/util"
 	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/convention/manifest"
 	"github.com/linecard/self/pkg/convention/release"
+	"github.com/linecard/self/pkg/service/bundle"
+	"github.com/linecard/self/pkg/service/signing"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 
@@ -14,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/smithy-go"
 	dockerTypes "github.com/docker/docker/api/types"
 	"github.com/rs/zerolog/log"
 )
@@ -32,19 +39,41 @@ type FunctionService interface {
 	PutFunction(ctx context.Context, put *lambda.CreateFunctionInput, concurreny int32) (*lambda.GetFunctionOutput, error)
 	PatchFunction(ctx context.Context, patch *lambda.UpdateFunctionConfigurationInput) (*lambda.GetFunctionConfigurationOutput, error)
 	EnsureEniGcRole(ctx context.Context) (*iam.GetRoleOutput, error)
+	PruneVersions(ctx context.Context, name string, keep int) ([]string, error)
 }
 
 type RegistryService interface {
 	InspectByDigest(ctx context.Context, registryId, repository, digest string) (dockerTypes.ImageInspect, error)
+	Signature(ctx context.Context, registryId, repository, digest string) ([]byte, error)
 }
 
+// PackageTag records the s3:// uri of a zip packaged deployment.
+const PackageTag = "Package"
+
 type Deployment struct {
 	lambda.GetFunctionOutput
 }
 
+// PackageService reads the sidecars of zip packages, as the registry reads image configs.
+type PackageService interface {
+	InspectByDigest(ctx context.Context, registryId, repository, digest string) (dockerTypes.ImageInspect, error)
+	Signature(ctx context.Context, registryId, repository, digest string) ([]byte, error)
+}
+
+// ReleaseReader reads the config of a release by digest, all FetchRelease needs of the registry and package bucket.
+type ReleaseReader interface {
+	InspectByDigest(ctx context.Context, registryId, repository, digest string) (dockerTypes.ImageInspect, error)
+}
+
+type SigningService interface {
+	Verify(ctx context.Context, trusted []string, payload []byte, signature signing.Signature) error
+}
+
 type Services struct {
 	Function FunctionService
 	Registry RegistryService
+	Package  PackageService
+	Signing  SigningService
 }
 
 type Convention struct {
@@ -52,12 +81,14 @@ type Convention struct {
 	Service Services
 }
 
-func FromServices(c config.Config, f FunctionService, r RegistryService) Convention {
+func FromServices(c config.Config, f FunctionService, r RegistryService, p PackageService, s SigningService) Convention {
 	return Convention{
 		Config: c,
 		Service: Services{
 			Function: f,
 			Registry: r,
+			Package:  p,
+			Signing:  s,
 		},
 	}
 }
@@ -91,6 +122,10 @@ func (c Convention) Deploy(ctx context.Context, r release.Release) (Deployment,
 
 	var err error
 
+	if err := c.verify(ctx, r); err != nil {
+		return Deployment{}, err
+	}
+
 	deploytime, err := c.Config.DeployTime(r.Config.Labels)
 	if err != nil {
 		return Deployment{}, err
@@ -156,6 +191,25 @@ func (c Convention) Deploy(ctx context.Context, r release.Release) (Deployment,
 		Publish: true,
 	}
 
+	if runtime, handler, ok := r.ZipPackage(); ok {
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(r.Uri, "s3://"), "/")
+
+		input.PackageType = types.PackageTypeZip
+		input.Runtime = types.Runtime(runtime)
+		input.Handler = aws.String(handler)
+		input.Code = &types.FunctionCode{
+			S3Bucket: aws.String(bucket),
+			S3Key:    aws.String(key),
+		}
+
+		// Lambda keeps no reference to the package, the tag lets FetchRelease find its sidecar.
+		input.Tags = make(map[string]string)
+		for key, value := range deploytime.Computed.Resource.Tags {
+			input.Tags[key] = value
+		}
+		input.Tags[PackageTag] = r.Uri
+	}
+
 	// Has VPC Config
 	if c.Config.Vpc.SecurityGroupIds != nil && c.Config.Vpc.SubnetIds != nil {
 		input.VpcConfig = &types.VpcConfig{
@@ -189,6 +243,7 @@ func (c Convention) Deploy(ctx context.Context, r release.Release) (Deployment,
 			return Deployment{}, err
 		}
 
+		c.pruneVersions(ctx, deploytime.Computed.Resource.Name)
 		return c.Find(ctx, deploytime.Computed.Resource.Name)
 	}
 
@@ -197,9 +252,35 @@ func (c Convention) Deploy(ctx context.Context, r release.Release) (Deployment,
 		return Deployment{}, err
 	}
 
+	c.pruneVersions(ctx, deploytime.Computed.Resource.Name)
 	return c.Find(ctx, deploytime.Computed.Resource.Name)
 }
 
+// Prune published versions of a deployment beyond the newest keep versions.
+func (c Convention) Prune(ctx context.Context, d Deployment, keep int) ([]string, error) {
+	ctx, span := otel.Tracer("").Start(ctx, "prune")
+	defer span.End()
+
+	pruned, err := c.Service.Function.PruneVersions(ctx, *d.Configuration.FunctionName, keep)
+	if err != nil {
+		return pruned, err
+	}
+
+	span.SetAttributes(attribute.StringSlice("pruned-versions", pruned))
+	return pruned, nil
+}
+
+// Pruning is housekeeping, a failure here should not fail the deployment.
+func (c Convention) pruneVersions(ctx context.Context, name string) {
+	if c.Config.Versions.Keep == 0 {
+		return
+	}
+
+	if _, err := c.Service.Function.PruneVersions(ctx, name, c.Config.Versions.Keep); err != nil {
+		log.Warn().Err(err).Msgf("failed to prune versions of %s", name)
+	}
+}
+
 func (c Convention) Destroy(ctx context.Context, d Deployment) error {
 	roleName := util.RoleNameFromArn(*d.Configuration.Role)
 
@@ -231,7 +312,24 @@ func (c Convention) Destroy(ctx context.Context, d Deployment) error {
 	return nil
 }
 
-func (d Deployment) FetchRelease(ctx context.Context, r RegistryService, registryId string) (release.Release, error) {
+// FetchRelease reads the release a deployment runs, from the registry or, for zip packages, from the package bucket.
+func (d Deployment) FetchRelease(ctx context.Context, r ReleaseReader, p ReleaseReader, registryId string) (release.Release, error) {
+	if d.Configuration.PackageType == types.PackageTypeZip {
+		uri := d.Tags[PackageTag]
+
+		_, repository, digest, err := bundle.ParseUri(uri)
+		if err != nil {
+			return release.Release{}, err
+		}
+
+		fetched, err := p.InspectByDigest(ctx, registryId, repository, digest)
+		if err != nil {
+			return release.Release{}, err
+		}
+
+		return release.Release{Image: release.Image{ImageInspect: fetched}, Uri: uri}, nil
+	}
+
 	pathIndex := strings.Index(*d.Code.ImageUri, "/")
 	imageTag := string(*d.Code.ImageUri)[pathIndex+1:]
 	repository := strings.Split(imageTag, "@sha256:")[0]
@@ -244,3 +342,64 @@ func (d Deployment) FetchRelease(ctx context.Context, r RegistryService, registr
 
 	return release.Release{Image: release.Image{ImageInspect: fetched}, Uri: *d.Code.ImageUri}, nil
 }
+
+// verify refuses releases that are unsigned, or whose signature does not cover their digest and labels,
+// when trusted keys are configured.
+func (c Convention) verify(ctx context.Context, r release.Release) error {
+	if len(c.Config.Signing.Trusted) == 0 {
+		return nil
+	}
+
+	var repository, digest string
+	var content []byte
+	var err error
+
+	if strings.HasPrefix(r.Uri, "s3://") {
+		var hex string
+		if _, repository, hex, err = bundle.ParseUri(r.Uri); err != nil {
+			return err
+		}
+
+		digest = "sha256:" + hex
+		content, err = c.Service.Package.Signature(ctx, c.Config.Registry.Id, repository, digest)
+	} else {
+		var found bool
+		_, path, _ := strings.Cut(r.Uri, "/")
+		if repository, digest, found = strings.Cut(path, "@"); !found {
+			return fmt.Errorf("release uri %s has no digest to verify", r.Uri)
+		}
+
+		// The uri of a multi-platform release names its platform image, the signature covers the index.
+		if r.Digest != "" {
+			digest = r.Digest
+		}
+
+		content, err = c.Service.Registry.Signature(ctx, c.Config.Registry.Id, repository, digest)
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ImageNotFoundException" {
+		return fmt.Errorf("refusing to deploy %s, it is not signed", r.Uri)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var signature signing.Signature
+	if err := json.Unmarshal(content, &signature); err != nil {
+		return fmt.Errorf("signature of %s: %w", r.Uri, err)
+	}
+
+	payload, err := manifest.Payload(digest, r.Config.Labels)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Service.Signing.Verify(ctx, c.Config.Signing.Trusted, payload, signature); err != nil {
+		return fmt.Errorf("refusing to deploy %s: %w", r.Uri, err)
+	}
+
+	log.Info().Msgf("verified %s signed by %s", r.Uri, signature.KeyId)
+	return nil
+}
@@ -0,0 +1,150 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/convention/manifest"
+	"github.com/linecard/self/pkg/convention/release"
+	"github.com/linecard/self/pkg/service/bundle"
+	"github.com/linecard/self/pkg/service/ledger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type LedgerService interface {
+	Put(ctx context.Context, record ledger.Record) error
+	List(ctx context.Context, function string) ([]ledger.Record, error)
+}
+
+type Services struct {
+	Ledger LedgerService
+}
+
+type Convention struct {
+	Config  config.Config
+	Service Services
+}
+
+func FromServices(c config.Config, l LedgerService) Convention {
+	return Convention{
+		Config: c,
+		Service: Services{
+			Ledger: l,
+		},
+	}
+}
+
+// Begin opens a record for the deployment of the given release, to be closed with Finish.
+func (c Convention) Begin(ctx context.Context, r release.Release) ledger.Record {
+	record := ledger.Record{
+		Caller:   c.Config.Caller.Arn,
+		Deployed: time.Now(),
+	}
+
+	if r.Digest != "" {
+		record.Digest = r.Digest
+	} else if _, digest, found := strings.Cut(r.Uri, "@"); found {
+		record.Digest = digest
+	} else if _, _, digest, err := bundle.ParseUri(r.Uri); err == nil {
+		record.Digest = "sha256:" + digest
+	}
+
+	if spanContext := trace.SpanFromContext(ctx).SpanContext(); spanContext.HasTraceID() {
+		record.TraceId = spanContext.TraceID().String()
+	}
+
+	deploytime, err := c.Config.DeployTime(r.Config.Labels)
+	if err != nil {
+		// The deployment will fail the same way, record it under what is known of the release.
+		record.Function = c.functionName(r)
+		record.Error = err.Error()
+		return record
+	}
+
+	record.Function = deploytime.Computed.Resource.Name
+	record.Branch = deploytime.Branch.Decoded
+	record.Sha = deploytime.Sha.Decoded
+
+	return record
+}
+
+// functionName solves the resource name of a release that cannot be decoded from the labels naming it,
+// so `self history` finds its failure. Without them, it falls back to the repository name.
+func (c Convention) functionName(r release.Release) string {
+	named := manifest.Init()
+
+	for _, label := range []*manifest.StringLabel{&named.Name, &named.Branch, &named.Sha, &named.Origin} {
+		if err := label.Decode(r.Config.Labels); err != nil {
+			return repositoryName(r.Uri)
+		}
+	}
+
+	deploytime := config.DeployTime{DeployTime: manifest.DeployTime{Release: named}}
+	resource, err := c.Config.SolveSibling(deploytime, named.Name.Decoded)
+	if err != nil {
+		return repositoryName(r.Uri)
+	}
+
+	return resource.Name
+}
+
+// repositoryName reads the repository out of an image or package uri, for records of releases that cannot be decoded.
+func repositoryName(uri string) string {
+	if _, repository, _, err := bundle.ParseUri(uri); err == nil {
+		return repository
+	}
+
+	_, path, _ := strings.Cut(uri, "/")
+	repository, _, _ := strings.Cut(path, "@")
+	if repository == "" {
+		return "unknown"
+	}
+
+	return repository
+}
+
+// Finish stamps the outcome of the deployment and writes the record to the ledger, if one is configured.
+func (c Convention) Finish(ctx context.Context, record ledger.Record, deployErr error) error {
+	if c.Service.Ledger == nil {
+		return nil
+	}
+
+	record.Duration = time.Since(record.Deployed)
+	record.Outcome = "Succeeded"
+
+	if deployErr != nil {
+		record.Outcome = "Failed"
+		record.Error = deployErr.Error()
+	}
+
+	return c.Service.Ledger.Put(ctx, record)
+}
+
+// List returns the function's records, newest first, along with those of its repository's releases
+// that could not be decoded well enough to name the function.
+func (c Convention) List(ctx context.Context, function, repository string) ([]ledger.Record, error) {
+	if c.Service.Ledger == nil {
+		return []ledger.Record{}, fmt.Errorf("no history ledger configured, set %s or %s", config.EnvHistoryTable, config.EnvHistoryPath)
+	}
+
+	records, err := c.Service.Ledger.List(ctx, function)
+	if err != nil {
+		return records, err
+	}
+
+	undecoded, err := c.Service.Ledger.List(ctx, repository)
+	if err != nil {
+		return records, err
+	}
+
+	records = append(records, undecoded...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Deployed.After(records[j].Deployed)
+	})
+
+	return records, nil
+}
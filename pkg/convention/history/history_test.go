@@ -0,0 +1,110 @@
+package history
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/convention/release"
+	"github.com/linecard/self/pkg/service/ledger"
+)
+
+func TestUndecodableReleaseIsRecorded(t *testing.T) {
+	ctx := context.Background()
+	l := ledger.FromPath(filepath.Join(t.TempDir(), "history.jsonl"))
+	c := FromServices(config.Config{}, l)
+
+	r := release.Release{
+		Image: release.Image{
+			ImageInspect: types.ImageInspect{Config: &container.Config{Labels: map[string]string{}}},
+		},
+		Uri: "123456789012.dkr.ecr.us-east-1.amazonaws.com/ns/api@sha256:abc",
+	}
+
+	record := c.Begin(ctx, r)
+	if err := c.Finish(ctx, record, errors.New("label required but not found")); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := l.List(ctx, "ns/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected the failed deployment to be recorded, got %d records", len(records))
+	}
+
+	if records[0].Outcome != "Failed" || records[0].Digest != "sha256:abc" {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+}
+
+func TestUndecodableReleaseIsListedWithItsFunction(t *testing.T) {
+	ctx := context.Background()
+	l := ledger.FromPath(filepath.Join(t.TempDir(), "history.jsonl"))
+	c := FromServices(config.Config{Resource: config.Resource{Namespace: "ns"}}, l)
+
+	encode := base64.StdEncoding.EncodeToString
+	named := release.Release{
+		Image: release.Image{
+			ImageInspect: types.ImageInspect{Config: &container.Config{Labels: map[string]string{
+				"org.linecard.self.name":       encode([]byte("api")),
+				"org.linecard.self.git.branch": encode([]byte("main")),
+				"org.linecard.self.git.sha":    encode([]byte("abc123")),
+				"org.linecard.self.git.origin": encode([]byte("https://github.com/ns/repo.git")),
+			}}},
+		},
+		Uri: "123456789012.dkr.ecr.us-east-1.amazonaws.com/ns/api@sha256:def",
+	}
+
+	unnamed := release.Release{
+		Image: release.Image{
+			ImageInspect: types.ImageInspect{Config: &container.Config{Labels: map[string]string{}}},
+		},
+		Uri: "123456789012.dkr.ecr.us-east-1.amazonaws.com/ns/api@sha256:abc",
+	}
+
+	for _, r := range []release.Release{unnamed, named} {
+		record := c.Begin(ctx, r)
+		if err := c.Finish(ctx, record, errors.New("label required but not found")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := l.List(ctx, "ns-main-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records[0].Digest != "sha256:def" {
+		t.Fatalf("expected the release naming its function under ns-main-api, got %+v", records)
+	}
+
+	if records, err = c.List(ctx, "ns-main-api", "ns/api"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].Digest != "sha256:def" || records[1].Digest != "sha256:abc" {
+		t.Errorf("expected both failures listed newest first, got %+v", records)
+	}
+}
+
+func TestRepositoryName(t *testing.T) {
+	cases := map[string]string{
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com/ns/api@sha256:abc": "ns/api",
+		"s3://packages/ns/api/sha256-abc.zip":                            "ns/api",
+		"":                                                               "unknown",
+	}
+
+	for uri, expected := range cases {
+		if got := repositoryName(uri); got != expected {
+			t.Errorf("repositoryName(%q) = %q, expected %q", uri, got, expected)
+		}
+	}
+}
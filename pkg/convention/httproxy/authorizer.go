@@ -0,0 +1,69 @@
+package httproxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/convention/deployment"
+)
+
+// convergeAuthorizer registers the function as a lambda authorizer when its resources.json declares one,
+// and deregisters it otherwise. The authorizer is named after the function, its invoke permission is
+// reconciled by the permission convention.
+func (c Convention) convergeAuthorizer(ctx context.Context, d deployment.Deployment, deploytime config.DeployTime) error {
+	apiId := *c.Config.ApiGateway.Id
+	authorizer := deploytime.Computed.Resources.Authorizer
+
+	if authorizer == nil {
+		return c.Service.Gateway.DeleteAuthorizer(ctx, apiId, *d.Configuration.FunctionName)
+	}
+
+	if strings.ToUpper(authorizer.Type) != "REQUEST" {
+		return fmt.Errorf("unsupported authorizer type %s, only REQUEST is supported", authorizer.Type)
+	}
+
+	_, err := c.Service.Gateway.PutAuthorizer(ctx, &apigatewayv2.CreateAuthorizerInput{
+		ApiId:                          aws.String(apiId),
+		Name:                           d.Configuration.FunctionName,
+		AuthorizerType:                 types.AuthorizerTypeRequest,
+		AuthorizerUri:                  aws.String("arn:aws:apigateway:" + c.Config.Account.Region + ":lambda:path/2015-03-31/functions/" + *d.Configuration.FunctionArn + "/invocations"),
+		AuthorizerPayloadFormatVersion: aws.String("2.0"),
+		AuthorizerResultTtlInSeconds:   aws.Int32(authorizer.Ttl),
+		EnableSimpleResponses:          authorizer.SimpleResponses,
+		IdentitySource:                 authorizer.IdentitySources,
+	})
+
+	return err
+}
+
+// resolveAuthorizerFunction finds the authorizer registered by another function, referenced either
+// by its bare name within the same namespace and branch, or by its full resource name.
+func (c Convention) resolveAuthorizerFunction(ctx context.Context, deploytime config.DeployTime, name string) (*string, error) {
+	sibling, err := c.Config.SolveSibling(deploytime, name)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{
+		sibling.Name,
+		name,
+	}
+
+	for _, candidate := range candidates {
+		authorizer, err := c.Service.Gateway.GetAuthorizerByName(ctx, *c.Config.ApiGateway.Id, candidate)
+		if err != nil {
+			return nil, err
+		}
+
+		if authorizer != nil {
+			return authorizer.AuthorizerId, nil
+		}
+	}
+
+	return nil, fmt.Errorf("authorizer function %s is not registered on api %s, deploy it first", name, *c.Config.ApiGateway.Id)
+}
@@ -0,0 +1,64 @@
+package httproxy
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/linecard/self/pkg/convention/config"
+)
+
+// HTTP APIs only configure CORS api-wide, so per-route CORS headers are stamped onto the
+// integration's responses instead, for each status code the route may answer with. Preflight
+// routes answer 204 whatever the function responds to OPTIONS.
+var corsStatusCodes = []int{200, 201, 202, 204, 206, 301, 302, 304, 400, 401, 403, 404, 405, 409, 422, 429, 500, 502, 503, 504}
+
+func corsResponseParameters(route config.ComputedRoute) map[string]map[string]string {
+	cors := route.Cors
+	if cors == nil {
+		return nil
+	}
+
+	headers := map[string]string{
+		"overwrite:header.Access-Control-Allow-Origin": "*",
+	}
+
+	if cors.AllowOrigin != "" {
+		headers["overwrite:header.Access-Control-Allow-Origin"] = cors.AllowOrigin
+	}
+
+	if len(cors.AllowMethods) > 0 {
+		headers["overwrite:header.Access-Control-Allow-Methods"] = strings.Join(cors.AllowMethods, ",")
+	}
+
+	if len(cors.AllowHeaders) > 0 {
+		headers["overwrite:header.Access-Control-Allow-Headers"] = strings.Join(cors.AllowHeaders, ",")
+	}
+
+	if len(cors.ExposeHeaders) > 0 {
+		headers["overwrite:header.Access-Control-Expose-Headers"] = strings.Join(cors.ExposeHeaders, ",")
+	}
+
+	if cors.MaxAge > 0 {
+		headers["overwrite:header.Access-Control-Max-Age"] = strconv.Itoa(int(cors.MaxAge))
+	}
+
+	if cors.AllowCredentials {
+		headers["overwrite:header.Access-Control-Allow-Credentials"] = "true"
+	}
+
+	if route.Preflight {
+		headers["overwrite:statuscode"] = "204"
+	}
+
+	statusCodes := cors.StatusCodes
+	if len(statusCodes) == 0 || route.Preflight {
+		statusCodes = corsStatusCodes
+	}
+
+	parameters := make(map[string]map[string]string)
+	for _, statusCode := range statusCodes {
+		parameters[strconv.Itoa(statusCode)] = headers
+	}
+
+	return parameters
+}
@@ -2,11 +2,13 @@ package httproxy
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/linecard/self/pkg/convention/config"
 	"github.com/linecard/self/pkg/convention/deployment"
 	"go.opentelemetry.io/otel"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
 	dockerTypes "github.com/docker/docker/api/types"
@@ -16,14 +18,20 @@ import (
 type GatewayService interface {
 	GetApi(ctx context.Context, apiId string) (*apigatewayv2.GetApiOutput, error)
 	GetApis(ctx context.Context) (*apigatewayv2.GetApisOutput, error)
-	PutIntegration(ctx context.Context, apiId, lambdaArn, routeKey string) (*apigatewayv2.GetIntegrationOutput, error)
+	PutIntegration(ctx context.Context, apiId, lambdaArn, routeKey, prefix, forwardedPrefix string, responseParameters map[string]map[string]string) (*apigatewayv2.GetIntegrationOutput, error)
 	PutRoute(ctx context.Context, apiId, integrationId, routeKey string, authType string, authorizerId *string) (*apigatewayv2.GetRouteOutput, error)
-	PutLambdaPermission(ctx context.Context, apiId, lambdaArn, routeKey string) error
 	DeleteIntegration(ctx context.Context, apiId string, route types.Route) error
 	DeleteRoute(ctx context.Context, apiId string, route types.Route) error
-	DeleteLambdaPermission(ctx context.Context, lambdaArn string, route types.Route) error
 	GetRouteByRouteKey(ctx context.Context, apiId, routeKey string) (types.Route, error)
 	GetRoutesByFunctionArn(ctx context.Context, apiId, functionArn string) ([]types.Route, error)
+	PutAuthorizer(ctx context.Context, input *apigatewayv2.CreateAuthorizerInput) (string, error)
+	GetAuthorizerByName(ctx context.Context, apiId, name string) (*types.Authorizer, error)
+	DeleteAuthorizer(ctx context.Context, apiId, name string) error
+	PutRouteThrottle(ctx context.Context, apiId, stage string, integration *apigatewayv2.GetIntegrationOutput, routeKey string, burst int32, rate float64) error
+	ResetRouteThrottle(ctx context.Context, apiId, stage string, integration *apigatewayv2.GetIntegrationOutput, routeKey string) error
+	DeleteRouteSettings(ctx context.Context, apiId, stage, routeKey string) error
+	PutDomainName(ctx context.Context, domainName, certificateArn string) error
+	PutApiMapping(ctx context.Context, apiId, domainName, basePath, stage string) error
 }
 
 type RegistryService interface {
@@ -33,6 +41,7 @@ type RegistryService interface {
 type Services struct {
 	Gateway  GatewayService
 	Registry RegistryService
+	Package  RegistryService
 }
 
 type Convention struct {
@@ -40,12 +49,13 @@ type Convention struct {
 	Service Services
 }
 
-func FromServices(c config.Config, g GatewayService, r RegistryService) Convention {
+func FromServices(c config.Config, g GatewayService, r, p RegistryService) Convention {
 	return Convention{
 		Config: c,
 		Service: Services{
 			Gateway:  g,
 			Registry: r,
+			Package:  p,
 		},
 	}
 }
@@ -54,26 +64,46 @@ func (c Convention) Converge(ctx context.Context, d deployment.Deployment) error
 	ctx, span := otel.Tracer("").Start(ctx, "httproxy.converge")
 	defer span.End()
 
+	release, err := d.FetchRelease(ctx, c.Service.Registry, c.Service.Package, c.Config.Registry.Id)
+	if err != nil {
+		return err
+	}
+
+	deploytime, err := c.Config.DeployTime(release.Config.Labels)
+	if err != nil {
+		return err
+	}
+
 	if c.Config.ApiGateway.Id == nil {
+		if deploytime.Computed.Resources.Http && deploytime.Computed.Resources.Gatewayed {
+			return fmt.Errorf("%s declares routes, jwt, cors or throttle but no api gateway was found, tag one with %s or set %s", deploytime.Computed.Resource.Name, config.TagDiscovery, config.EnvGwId)
+		}
+
 		log.Info().Msg("no api gateway defined, clearing associated proxy routes")
 		return c.Unmount(ctx, d)
 	}
 
-	release, err := d.FetchRelease(ctx, c.Service.Registry, c.Config.Registry.Id)
-	if err != nil {
+	if err := c.convergeAuthorizer(ctx, d, deploytime); err != nil {
 		return err
 	}
 
-	deploytime, err := c.Config.DeployTime(release.Config.Labels)
-	if err != nil {
+	if !deploytime.Computed.Resources.Http {
+		return c.unmount(ctx, d, false)
+	}
+
+	if err := c.Mount(ctx, d); err != nil {
 		return err
 	}
 
-	if !deploytime.Computed.Resources.Http {
-		return c.Unmount(ctx, d)
+	if err := c.prune(ctx, d, deploytime.Computed.Resources.Routes); err != nil {
+		return err
 	}
 
-	return c.Mount(ctx, d)
+	if deploytime.Computed.Resources.Jwt == nil {
+		return c.Service.Gateway.DeleteAuthorizer(ctx, *c.Config.ApiGateway.Id, jwtAuthorizerName(*d.Configuration.FunctionName))
+	}
+
+	return nil
 }
 
 func (c Convention) Mount(ctx context.Context, d deployment.Deployment) error {
@@ -82,7 +112,7 @@ func (c Convention) Mount(ctx context.Context, d deployment.Deployment) error {
 		return nil
 	}
 
-	release, err := d.FetchRelease(ctx, c.Service.Registry, c.Config.Registry.Id)
+	release, err := d.FetchRelease(ctx, c.Service.Registry, c.Service.Package, c.Config.Registry.Id)
 	if err != nil {
 		return err
 	}
@@ -92,50 +122,182 @@ func (c Convention) Mount(ctx context.Context, d deployment.Deployment) error {
 		return err
 	}
 
-	integration, err := c.Service.Gateway.PutIntegration(
-		ctx, *c.Config.ApiGateway.Id,
-		*d.Configuration.FunctionArn,
-		deploytime.Computed.Resources.RouteKey,
-	)
+	if err := c.putDomain(ctx, deploytime); err != nil {
+		return err
+	}
 
+	jwtAuthorizerId, err := c.putJwtAuthorizer(ctx, deploytime)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.Service.Gateway.PutRoute(
+	for _, route := range deploytime.Computed.Resources.Routes {
+		authorizerId := route.AuthorizerId
+		if route.AuthType == "JWT" && authorizerId == nil {
+			if jwtAuthorizerId == nil {
+				return fmt.Errorf("route %s uses JWT authorization but neither jwt nor authorizerId is declared", route.RouteKey)
+			}
+			authorizerId = jwtAuthorizerId
+		}
+
+		if route.AuthType == "CUSTOM" && authorizerId == nil && route.AuthorizerFunction != "" {
+			authorizerId, err = c.resolveAuthorizerFunction(ctx, deploytime, route.AuthorizerFunction)
+			if err != nil {
+				return err
+			}
+		}
+
+		integration, err := c.Service.Gateway.PutIntegration(
+			ctx, *c.Config.ApiGateway.Id,
+			*d.Configuration.FunctionArn,
+			route.RouteKey,
+			route.Prefix,
+			route.ForwardedPrefix,
+			corsResponseParameters(route),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = c.Service.Gateway.PutRoute(
+			ctx,
+			*c.Config.ApiGateway.Id,
+			*integration.IntegrationId,
+			route.RouteKey,
+			route.AuthType,
+			authorizerId,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if err = c.putThrottle(ctx, integration, route); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putThrottle reconciles the stage route settings of the route with its declared throttle. Settings
+// are only reset where self throttled the route, not where an administrator did.
+func (c Convention) putThrottle(ctx context.Context, integration *apigatewayv2.GetIntegrationOutput, route config.ComputedRoute) error {
+	if route.Throttle == nil {
+		return c.Service.Gateway.ResetRouteThrottle(ctx, *c.Config.ApiGateway.Id, c.Config.ApiGateway.Stage, integration, route.RouteKey)
+	}
+
+	return c.Service.Gateway.PutRouteThrottle(
 		ctx,
 		*c.Config.ApiGateway.Id,
-		*integration.IntegrationId,
-		deploytime.Computed.Resources.RouteKey,
-		deploytime.Computed.Resources.AuthType,
-		deploytime.Computed.Resources.AuthorizerId,
+		c.Config.ApiGateway.Stage,
+		integration,
+		route.RouteKey,
+		route.Throttle.Burst,
+		route.Throttle.Rate,
 	)
+}
 
-	if err != nil {
+// putDomain maps the api onto the custom domain declared for the function, if any.
+// Mappings are left in place on unmount, other functions may be served under the same base path.
+func (c Convention) putDomain(ctx context.Context, deploytime config.DeployTime) error {
+	domain := deploytime.Computed.Resources.Domain
+	if domain == nil {
+		return nil
+	}
+
+	if err := c.Service.Gateway.PutDomainName(ctx, domain.Name, domain.CertificateArn); err != nil {
 		return err
 	}
 
-	err = c.Service.Gateway.PutLambdaPermission(
-		ctx,
-		*c.Config.ApiGateway.Id,
-		*d.Configuration.FunctionArn,
-		deploytime.Computed.Resources.RouteKey,
-	)
+	return c.Service.Gateway.PutApiMapping(ctx, *c.Config.ApiGateway.Id, domain.Name, domain.BasePath, c.Config.ApiGateway.Stage)
+}
+
+// putJwtAuthorizer ensures the JWT authorizer declared in resources.json, if any, returning its id.
+func (c Convention) putJwtAuthorizer(ctx context.Context, deploytime config.DeployTime) (*string, error) {
+	jwt := deploytime.Computed.Resources.Jwt
+	if jwt == nil {
+		return nil, nil
+	}
+
+	if jwt.Issuer == "" {
+		return nil, fmt.Errorf("jwt authorizer for %s requires an issuer", deploytime.Computed.Resource.Name)
+	}
+
+	authorizerId, err := c.Service.Gateway.PutAuthorizer(ctx, &apigatewayv2.CreateAuthorizerInput{
+		ApiId:          c.Config.ApiGateway.Id,
+		Name:           aws.String(jwtAuthorizerName(deploytime.Computed.Resource.Name)),
+		AuthorizerType: types.AuthorizerTypeJwt,
+		IdentitySource: jwt.IdentitySource,
+		JwtConfiguration: &types.JWTConfiguration{
+			Issuer:   aws.String(jwt.Issuer),
+			Audience: jwt.Audience,
+		},
+	})
 
+	if err != nil {
+		return nil, err
+	}
+
+	return &authorizerId, nil
+}
+
+func jwtAuthorizerName(resourceName string) string {
+	return resourceName + "-jwt"
+}
+
+// prune removes routes still integrated with the function that are no longer declared.
+func (c Convention) prune(ctx context.Context, d deployment.Deployment, desired []config.ComputedRoute) error {
+	declared := make(map[string]bool)
+	for _, route := range desired {
+		declared[route.RouteKey] = true
+	}
+
+	routes, err := c.Service.Gateway.GetRoutesByFunctionArn(ctx, *c.Config.ApiGateway.Id, *d.Configuration.FunctionArn)
 	if err != nil {
 		return err
 	}
 
+	for _, route := range routes {
+		if declared[*route.RouteKey] {
+			continue
+		}
+
+		log.Info().Msgf("removing stale route %s", *route.RouteKey)
+
+		if err = c.Service.Gateway.DeleteRoute(ctx, *c.Config.ApiGateway.Id, route); err != nil {
+			return err
+		}
+
+		if err = c.Service.Gateway.DeleteIntegration(ctx, *c.Config.ApiGateway.Id, route); err != nil {
+			return err
+		}
+
+		if err = c.Service.Gateway.DeleteRouteSettings(ctx, *c.Config.ApiGateway.Id, c.Config.ApiGateway.Stage, *route.RouteKey); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (c Convention) Unmount(ctx context.Context, d deployment.Deployment) error {
+	return c.unmount(ctx, d, true)
+}
+
+// unmount removes the function's routes from every api, and its lambda authorizer if asked to.
+func (c Convention) unmount(ctx context.Context, d deployment.Deployment, authorizer bool) error {
 	apis, err := c.Service.Gateway.GetApis(ctx)
 	if err != nil {
 		return err
 	}
 
 	for _, api := range apis.Items {
+		if !c.Config.ApiGateway.Manages(api) {
+			continue
+		}
+
 		routes, err := c.Service.Gateway.GetRoutesByFunctionArn(ctx, *api.ApiId, *d.Configuration.FunctionArn)
 		if err != nil {
 			return err
@@ -147,16 +309,30 @@ func (c Convention) Unmount(ctx context.Context, d deployment.Deployment) error
 				return err
 			}
 
-			err = c.Service.Gateway.DeleteLambdaPermission(ctx, *d.Configuration.FunctionArn, route)
+			err = c.Service.Gateway.DeleteIntegration(ctx, *api.ApiId, route)
 			if err != nil {
 				return err
 			}
 
-			err = c.Service.Gateway.DeleteIntegration(ctx, *api.ApiId, route)
+			err = c.Service.Gateway.DeleteRouteSettings(ctx, *api.ApiId, c.Config.ApiGateway.Stage, *route.RouteKey)
 			if err != nil {
 				return err
 			}
 		}
+
+		err = c.Service.Gateway.DeleteAuthorizer(ctx, *api.ApiId, jwtAuthorizerName(*d.Configuration.FunctionName))
+		if err != nil {
+			return err
+		}
+
+		if !authorizer {
+			continue
+		}
+
+		err = c.Service.Gateway.DeleteAuthorizer(ctx, *api.ApiId, *d.Configuration.FunctionName)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -7,6 +7,10 @@ type DeployTime struct {
 func Decode(labels map[string]string, templateData any) (d DeployTime, err error) {
 	s := Init()
 
+	if labels, err = migrate(labels); err != nil {
+		return
+	}
+
 	if d, err = s.decode(labels); err != nil {
 		return
 	}
@@ -55,6 +59,20 @@ func (r *Release) decode(labels map[string]string) (d DeployTime, err error) {
 		return d, err
 	}
 
+	if err = r.Allowlist.Decode(labels); err != nil {
+		return d, err
+	}
+
+	if err = r.OpenApi.Decode(labels); err != nil {
+		return d, err
+	}
+
+	for _, optional := range []*StringLabel{&r.Author, &r.Subject, &r.Committed, &r.RunUrl, &r.Version} {
+		if err = optional.Decode(labels); err != nil {
+			return d, err
+		}
+	}
+
 	return DeployTime{Release: *r}, nil
 }
 
@@ -1,7 +1,11 @@
 package manifest
 
 import (
+	"encoding/base64"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/linecard/self/internal/gitlib"
 )
@@ -10,12 +14,16 @@ type BuildTime struct {
 	Release
 }
 
-func Encode(path string, git gitlib.DotGit) (b BuildTime, err error) {
+func Encode(path string, git gitlib.DotGit, provenance Provenance, options Options) (b BuildTime, err error) {
 	s := Init()
 	name := filepath.Base(path)
 
-	if err = s.Schema.Encode(schemaVersion); err != nil {
-		return b, err
+	if !options.Compress {
+		s.Policy.Compress = false
+		s.Resources.Compress = false
+		s.Bus.Compress = false
+		s.Allowlist.Compress = false
+		s.OpenApi.Compress = false
 	}
 
 	if err = s.Name.Encode(name); err != nil {
@@ -50,15 +58,64 @@ func Encode(path string, git gitlib.DotGit) (b BuildTime, err error) {
 		return b, err
 	}
 
-	return BuildTime{
-		Release: s,
-	}, nil
+	allowlist := filepath.Join(path, AllowlistFile)
+	if _, err := os.Stat(allowlist); err != nil && git.Root != "" {
+		allowlist = filepath.Join(git.Root, AllowlistFile)
+	}
+
+	if err = s.Allowlist.Encode(allowlist); err != nil {
+		return b, err
+	}
+
+	if err = s.Author.Encode(git.Commit.Author); err != nil {
+		return b, err
+	}
+
+	if err = s.Subject.Encode(git.Commit.Subject); err != nil {
+		return b, err
+	}
+
+	if !git.Commit.Time.IsZero() {
+		if err = s.Committed.Encode(git.Commit.Time.UTC().Format(time.RFC3339)); err != nil {
+			return b, err
+		}
+	}
+
+	if err = s.RunUrl.Encode(provenance.RunUrl); err != nil {
+		return b, err
+	}
+
+	if err = s.Version.Encode(provenance.Version); err != nil {
+		return b, err
+	}
+
+	b = BuildTime{Release: s}
+	err = b.Schema.Encode(b.schemaVersion())
+	return b, err
 }
 
+// EncodedLabels returns the release's labels, stamped with the schema version they need.
 func (b BuildTime) EncodedLabels() map[string]string {
+	m := b.labels()
+	m[b.Schema.Key] = base64.StdEncoding.EncodeToString([]byte(b.schemaVersion()))
+	return m
+}
+
+// schemaVersion is the oldest schema reading the labels. Labels may be encoded after Encode, the OpenAPI
+// document is, so it is worked out from the labels as they are now.
+func (b BuildTime) schemaVersion() string {
+	for _, value := range b.labels() {
+		if strings.HasPrefix(value, gzipPrefix) {
+			return schemaVersion
+		}
+	}
+
+	return plainSchemaVersion
+}
+
+func (b BuildTime) labels() map[string]string {
 	m := make(map[string]string)
 
-	m[b.Schema.Key] = b.Schema.Encoded
 	m[b.Name.Key] = b.Name.Encoded
 	m[b.Branch.Key] = b.Branch.Encoded
 	m[b.Sha.Key] = b.Sha.Encoded
@@ -67,6 +124,18 @@ func (b BuildTime) EncodedLabels() map[string]string {
 	m[b.Policy.Key] = b.Policy.Encoded
 	m[b.Resources.Key] = b.Resources.Encoded
 
+	for _, optional := range []StringLabel{b.Author, b.Subject, b.Committed, b.RunUrl, b.Version} {
+		if optional.Encoded != "" {
+			m[optional.Key] = optional.Encoded
+		}
+	}
+
+	for _, optional := range []FileLabel{b.Allowlist, b.OpenApi} {
+		if optional.Encoded != "" {
+			m[optional.Key] = optional.Encoded
+		}
+	}
+
 	for _, bus := range b.Bus.Content {
 		m[bus.Key] = bus.Encoded
 	}
@@ -2,10 +2,12 @@ package manifest
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -26,6 +28,7 @@ type FileLabel struct {
 	Encoded     string
 	Key         string
 	Required    bool
+	Compress    bool
 }
 
 type EmbeddedFileLabel struct {
@@ -34,6 +37,7 @@ type EmbeddedFileLabel struct {
 	Encoded     string
 	Key         string
 	Required    bool
+	Compress    bool
 }
 
 type FolderLabel struct {
@@ -41,6 +45,54 @@ type FolderLabel struct {
 	Content     []FileLabel
 	KeyPrefix   string
 	Required    bool
+	Compress    bool
+}
+
+// gzipPrefix flags a label value as gzipped before base64 encoding. ':' is not in the base64 alphabet,
+// so plain labels are never mistaken for compressed ones.
+const gzipPrefix = "gzip:"
+
+// encodeContent base64 encodes label content, gzipping it first when asked and when that makes it smaller.
+func encodeContent(content []byte, compress bool) (string, error) {
+	plain := base64.StdEncoding.EncodeToString(content)
+	if !compress {
+		return plain, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(content); err != nil {
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	compressed := gzipPrefix + base64.StdEncoding.EncodeToString(buf.Bytes())
+	if len(compressed) >= len(plain) {
+		return plain, nil
+	}
+
+	return compressed, nil
+}
+
+// decodeContent reads a label value, whether compressed or not.
+func decodeContent(value string) ([]byte, error) {
+	encoded, compressed := strings.CutPrefix(value, gzipPrefix)
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !compressed {
+		return decoded, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
 }
 
 func templateString(content string, data any) (string, error) {
@@ -69,7 +121,7 @@ func (s *StringLabel) Encode(content string) error {
 func (s *StringLabel) Decode(labels map[string]string) error {
 	for k, v := range labels {
 		if k == s.Key {
-			decoded, err := base64.StdEncoding.DecodeString(v)
+			decoded, err := decodeContent(v)
 			if err != nil {
 				return err
 			}
@@ -118,21 +170,21 @@ func (f *EmbeddedFileLabel) Encode(path string) error {
 		compacted := Compact(byteContent)
 
 		f.Decoded = string(compacted)
-		f.Encoded = base64.StdEncoding.EncodeToString(compacted)
-		return nil
+		f.Encoded, err = encodeContent(compacted, f.Compress)
+		return err
 	}
 
 	chomped := strings.TrimSuffix(string(byteContent), "\r\n")
 	chomped = strings.TrimPrefix(chomped, "\r\n")
 	f.Decoded = chomped
-	f.Encoded = base64.StdEncoding.EncodeToString([]byte(chomped))
-	return nil
+	f.Encoded, err = encodeContent([]byte(chomped), f.Compress)
+	return err
 }
 
 func (f *EmbeddedFileLabel) Decode(labels map[string]string) error {
 	for k, v := range labels {
 		if k == f.Key {
-			decoded, err := base64.StdEncoding.DecodeString(v)
+			decoded, err := decodeContent(v)
 			if err != nil {
 				return err
 			}
@@ -179,24 +231,29 @@ func (f *FileLabel) Encode(path string) error {
 			return fmt.Errorf("invalid JSON in %s", path)
 		}
 
-		compacted := Compact(byteContent)
-
-		f.Decoded = string(compacted)
-		f.Encoded = base64.StdEncoding.EncodeToString(compacted)
-		return nil
+		return f.EncodeJson(byteContent)
 	}
 
 	chomped := strings.TrimSuffix(string(byteContent), "\r\n")
 	chomped = strings.TrimPrefix(chomped, "\r\n")
 	f.Decoded = chomped
-	f.Encoded = base64.StdEncoding.EncodeToString([]byte(chomped))
-	return nil
+	f.Encoded, err = encodeContent([]byte(chomped), f.Compress)
+	return err
+}
+
+// EncodeJson sets the label to generated JSON content rather than that of a file.
+func (f *FileLabel) EncodeJson(content []byte) (err error) {
+	compacted := Compact(content)
+
+	f.Decoded = string(compacted)
+	f.Encoded, err = encodeContent(compacted, f.Compress)
+	return err
 }
 
 func (f *FileLabel) Decode(labels map[string]string) error {
 	for k, v := range labels {
 		if k == f.Key {
-			decoded, err := base64.StdEncoding.DecodeString(v)
+			decoded, err := decodeContent(v)
 			if err != nil {
 				return err
 			}
@@ -256,6 +313,7 @@ func (f *FolderLabel) Encode(parentPath string) error {
 				Description: "Individual embedded bus template",
 				Key:         label,
 				Required:    true,
+				Compress:    f.Compress,
 			}
 
 			if err := encodedFile.Encode(childPath); err != nil {
@@ -282,7 +340,7 @@ func (f *FolderLabel) Encode(parentPath string) error {
 func (f *FolderLabel) Decode(labels map[string]string) error {
 	for k, v := range labels {
 		if strings.HasPrefix(k, f.KeyPrefix) {
-			decodedLabel, err := base64.StdEncoding.DecodeString(v)
+			decodedLabel, err := decodeContent(v)
 			if err != nil {
 				return err
 			}
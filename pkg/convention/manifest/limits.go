@@ -0,0 +1,54 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits IAM and EventBridge put on what a release deploys. Exceeding them only fails at deploy time.
+const (
+	// IAM does not count whitespace toward the size of managed policies.
+	maxPolicyLength = 6144
+	// Role trust policies, at IAM's default quota.
+	maxRoleLength         = 2048
+	maxEventPatternLength = 4096
+	maxScheduleLength     = 256
+)
+
+// Validate checks the templated policies and bus rules of a release fit the limits IAM and EventBridge enforce.
+func (d DeployTime) Validate() error {
+	if n := policyLength(d.Policy.Decoded); n > maxPolicyLength {
+		return fmt.Errorf("policy is %d characters, over the %d IAM allows", n, maxPolicyLength)
+	}
+
+	if n := policyLength(d.Role.Decoded); n > maxRoleLength {
+		return fmt.Errorf("role trust policy is %d characters, over the %d IAM allows", n, maxRoleLength)
+	}
+
+	for _, bus := range d.Bus.Content {
+		content := strings.TrimSpace(bus.Decoded)
+		limit := maxEventPatternLength
+
+		if strings.HasPrefix(content, "cron(") || strings.HasPrefix(content, "rate(") {
+			limit = maxScheduleLength
+		}
+
+		if n := utf8.RuneCountInString(content); n > limit {
+			return fmt.Errorf("bus rule %s is %d characters, over the %d EventBridge allows", bus.Key, n, limit)
+		}
+	}
+
+	return nil
+}
+
+func policyLength(policy string) int {
+	var n int
+	for _, r := range policy {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
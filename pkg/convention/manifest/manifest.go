@@ -2,13 +2,18 @@ package manifest
 
 import (
 	"embed"
+	"encoding/json"
+	"strings"
 )
 
 //go:embed embedded/*
 var embedded embed.FS
 
 const (
-	schemaVersion = "1.1"
+	schemaVersion = "1.2"
+	// plainSchemaVersion stamps releases without gzipped labels, so deployers that predate compression
+	// still read them.
+	plainSchemaVersion = "1.1"
 )
 
 type Release struct {
@@ -21,8 +26,31 @@ type Release struct {
 	Policy    FileLabel
 	Resources FileLabel
 	Bus       FolderLabel
+	Allowlist FileLabel
+	OpenApi   FileLabel
+	Author    StringLabel
+	Subject   StringLabel
+	Committed StringLabel
+	RunUrl    StringLabel
+	Version   StringLabel
 }
 
+// Options change how a release's labels are encoded.
+type Options struct {
+	// Compress gzips the labels flagged for it, where that makes them smaller.
+	Compress bool
+}
+
+// Provenance is what built a release, beyond the commit it was built from.
+type Provenance struct {
+	RunUrl  string
+	Version string
+}
+
+// AllowlistFile lists vulnerability ids accepted by the scan gate, one per line. It is read from the
+// function's directory, falling back to the repository root, and travels with the release.
+const AllowlistFile = "scan-allowlist"
+
 func Init() Release {
 	return Release{
 		Schema: StringLabel{
@@ -59,16 +87,79 @@ func Init() Release {
 			Description: "Policy template file",
 			Key:         "org.linecard.self.policy",
 			Required:    true,
+			Compress:    true,
 		},
 		Resources: FileLabel{
 			Description: "Resources template file",
 			Key:         "org.linecard.self.resources",
 			Required:    false,
+			Compress:    true,
 		},
 		Bus: FolderLabel{
 			Description: "Bus templates path",
 			KeyPrefix:   "org.linecard.self.bus",
 			Required:    false,
+			Compress:    true,
+		},
+		Allowlist: FileLabel{
+			Description: "Scan allowlist file",
+			Key:         "org.linecard.self.scan.allowlist",
+			Required:    false,
+			Compress:    true,
+		},
+		OpenApi: FileLabel{
+			Description: "OpenAPI document of the function's routes",
+			Key:         "org.linecard.self.openapi",
+			Required:    false,
+			Compress:    true,
+		},
+		Author: StringLabel{
+			Description: "Git commit author string",
+			Key:         "org.linecard.self.git.author",
+			Required:    false,
+		},
+		Subject: StringLabel{
+			Description: "Git commit subject string",
+			Key:         "org.linecard.self.git.subject",
+			Required:    false,
+		},
+		Committed: StringLabel{
+			Description: "Git commit time string",
+			Key:         "org.linecard.self.git.committed",
+			Required:    false,
+		},
+		RunUrl: StringLabel{
+			Description: "CI run url string",
+			Key:         "org.linecard.self.ci.run",
+			Required:    false,
+		},
+		Version: StringLabel{
+			Description: "Self version string",
+			Key:         "org.linecard.self.version",
+			Required:    false,
 		},
 	}
 }
+
+// LabelPrefix starts the key of every release label.
+const LabelPrefix = "org.linecard.self."
+
+// Payload is what a release's signature is made over: its digest and its release labels, canonically encoded.
+// Other labels, such as those of the base image, are left out.
+func Payload(digest string, labels map[string]string) ([]byte, error) {
+	release := make(map[string]string)
+	for key, value := range labels {
+		if strings.HasPrefix(key, LabelPrefix) {
+			release[key] = value
+		}
+	}
+
+	// Maps marshal with sorted keys, so the encoding is the same wherever the labels were read from.
+	return json.Marshal(struct {
+		Digest string            `json:"digest"`
+		Labels map[string]string `json:"labels"`
+	}{
+		Digest: "sha256:" + strings.TrimPrefix(digest, "sha256:"),
+		Labels: release,
+	})
+}
@@ -0,0 +1,124 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// Migration rewrites the labels of a release from one schema version into those of the next. The schema
+// label is left as published, so a decoded release still reports the version it was built with.
+type Migration func(labels map[string]string) (map[string]string, error)
+
+type schema struct {
+	Version string
+	// Migrate brings labels of this version up to the next one registered. The current version has none.
+	Migrate Migration
+}
+
+// schemas registers each schema version this build can decode, oldest first, ending with schemaVersion.
+// Releases of older versions are migrated up to the current one before decoding, so the deployer and
+// CLI, which are upgraded separately, both read whatever the other published.
+var schemas = []schema{
+	{Version: "1.1", Migrate: migrateGzip},
+	{Version: schemaVersion},
+}
+
+// migrateGzip brings 1.1 labels to 1.2, which may be gzipped. Labels of 1.1 are all plain base64,
+// which 1.2 decodes as is, so a 1.1 release carrying compressed labels is malformed.
+func migrateGzip(labels map[string]string) (map[string]string, error) {
+	for key, value := range labels {
+		if strings.HasPrefix(key, LabelPrefix) && strings.HasPrefix(value, gzipPrefix) {
+			return nil, fmt.Errorf("label %s is compressed, which schema 1.1 does not allow", key)
+		}
+	}
+
+	return labels, nil
+}
+
+// migrate brings labels of any registered schema version up to the current one. Releases of a schema newer
+// than this build knows are refused, rather than deployed with labels it would misread.
+func migrate(labels map[string]string) (map[string]string, error) {
+	key := Init().Schema.Key
+
+	encoded, found := labels[key]
+	if !found {
+		return nil, fmt.Errorf("label %s required but not found", key)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	version := string(decoded)
+
+	for i, s := range schemas {
+		if s.Version != version {
+			continue
+		}
+
+		// The published labels are left untouched, signatures are verified against them.
+		labels = maps.Clone(labels)
+
+		for _, next := range schemas[i:] {
+			if next.Migrate == nil {
+				break
+			}
+
+			if labels, err = next.Migrate(labels); err != nil {
+				return nil, fmt.Errorf("migrating schema %s: %w", next.Version, err)
+			}
+		}
+
+		return labels, nil
+	}
+
+	if newer, err := newerVersion(version, schemaVersion); err != nil {
+		return nil, err
+	} else if newer {
+		return nil, fmt.Errorf("release schema %s is newer than %s, the newest this version of self reads, upgrade self to deploy it", version, schemaVersion)
+	}
+
+	return nil, fmt.Errorf("release schema %s is no longer supported, rebuild the release", version)
+}
+
+// newerVersion compares "major.minor" schema versions.
+func newerVersion(version, than string) (bool, error) {
+	a, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := parseVersion(than)
+	if err != nil {
+		return false, err
+	}
+
+	if a[0] != b[0] {
+		return a[0] > b[0], nil
+	}
+
+	return a[1] > b[1], nil
+}
+
+func parseVersion(version string) ([2]int, error) {
+	var parsed [2]int
+
+	major, minor, _ := strings.Cut(version, ".")
+	for i, part := range []string{major, minor} {
+		if part == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, fmt.Errorf("invalid schema version %q", version)
+		}
+		parsed[i] = n
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,281 @@
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/linecard/self/pkg/convention/config"
+	"go.opentelemetry.io/otel"
+	"gopkg.in/yaml.v3"
+)
+
+// Fragment is the optional per-function document merged into the composed one.
+// Its paths are relative to the function's route prefix, like the routes of resources.json.
+const Fragment = "openapi.yaml"
+
+type Document = map[string]any
+
+type Convention struct {
+	Config config.Config
+}
+
+func FromServices(c config.Config) Convention {
+	return Convention{
+		Config: c,
+	}
+}
+
+// Compose builds an OpenAPI 3 document of every route mounted by the selfish functions in the repository.
+func (c Convention) Compose(ctx context.Context) (Document, error) {
+	_, span := otel.Tracer("").Start(ctx, "openapi.compose")
+	defer span.End()
+
+	paths := Document{}
+	components := Document{}
+
+	for _, selfish := range c.Config.Selfish {
+		buildtime, err := c.Config.BuildTime(selfish.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := add(paths, components, buildtime, selfish.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	return document(c.Config.Repository.Namespace, c.Config.Git.Sha, paths, components), nil
+}
+
+// Function builds the OpenAPI 3 document of a single function's routes, as published with its release.
+// Functions without routes have none.
+func Function(buildtime config.BuildTime, functionPath string) (Document, error) {
+	resources := buildtime.Computed.Resources
+	if !resources.Http || len(resources.Routes) == 0 {
+		return nil, nil
+	}
+
+	paths := Document{}
+	components := Document{}
+
+	if err := add(paths, components, buildtime, functionPath); err != nil {
+		return nil, err
+	}
+
+	return document(buildtime.Computed.Resource.Name, buildtime.Sha.Decoded, paths, components), nil
+}
+
+// add describes the routes of a function in paths, merging its fragment over them.
+func add(paths, components Document, buildtime config.BuildTime, functionPath string) error {
+	resources := buildtime.Computed.Resources
+	if !resources.Http || len(resources.Routes) == 0 {
+		return nil
+	}
+
+	for _, route := range resources.Routes {
+		if route.Preflight {
+			continue
+		}
+
+		method, path, _ := strings.Cut(route.RouteKey, " ")
+		operation, scheme, schemeName := operationFor(buildtime, route)
+
+		if scheme != nil {
+			child(components, "securitySchemes")[schemeName] = scheme
+		}
+
+		child(paths, path)[methodKey(method)] = operation
+	}
+
+	fragment, err := readFragment(functionPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Join(functionPath, Fragment), err)
+	}
+
+	if fragmentPaths, ok := fragment["paths"].(Document); ok {
+		prefix := resources.Routes[0].Prefix
+		for path, item := range fragmentPaths {
+			if path == "/" {
+				path = ""
+			}
+
+			if item, ok := item.(Document); ok {
+				merge(child(paths, prefix+path), item)
+			}
+		}
+	}
+
+	if fragmentComponents, ok := fragment["components"].(Document); ok {
+		merge(components, fragmentComponents)
+	}
+
+	return nil
+}
+
+func document(title, version string, paths, components Document) Document {
+	document := Document{
+		"openapi": "3.0.3",
+		"info": Document{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+	}
+
+	if len(components) > 0 {
+		document["components"] = components
+	}
+
+	return document
+}
+
+// operationFor describes a route, returning the security scheme it requires if any.
+func operationFor(buildtime config.BuildTime, route config.ComputedRoute) (Document, Document, string) {
+	var scheme Document
+	var schemeName string
+
+	method, path, _ := strings.Cut(route.RouteKey, " ")
+	resources := buildtime.Computed.Resources
+
+	operation := Document{
+		"operationId": operationId(buildtime.Computed.Resource.Name, method, strings.TrimPrefix(path, route.Prefix)),
+		"tags":        []string{buildtime.Name.Decoded},
+		"responses": Document{
+			"default": Document{
+				"description": "Response from " + buildtime.Computed.Resource.Name,
+			},
+		},
+	}
+
+	if parameters := pathParameters(path); len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	switch route.AuthType {
+	case "AWS_IAM":
+		schemeName = "sigv4"
+		scheme = Document{
+			"type":                         "apiKey",
+			"name":                         "Authorization",
+			"in":                           "header",
+			"x-amazon-apigateway-authtype": "awsSigv4",
+		}
+	case "JWT":
+		schemeName = buildtime.Computed.Resource.Name + "-jwt"
+		scheme = Document{
+			"type":         "http",
+			"scheme":       "bearer",
+			"bearerFormat": "JWT",
+		}
+		if resources.Jwt != nil {
+			scheme["x-amazon-apigateway-authorizer"] = Document{
+				"type":           "jwt",
+				"identitySource": strings.Join(resources.Jwt.IdentitySource, ","),
+				"jwtConfiguration": Document{
+					"issuer":   resources.Jwt.Issuer,
+					"audience": resources.Jwt.Audience,
+				},
+			}
+		} else if route.AuthorizerId != nil {
+			schemeName = *route.AuthorizerId
+		}
+	case "CUSTOM":
+		schemeName = "custom"
+		if route.AuthorizerFunction != "" {
+			schemeName = route.AuthorizerFunction
+		} else if route.AuthorizerId != nil {
+			schemeName = *route.AuthorizerId
+		}
+		scheme = Document{
+			"type": "apiKey",
+			"name": "Authorization",
+			"in":   "header",
+		}
+	}
+
+	if scheme != nil {
+		operation["security"] = []Document{{schemeName: []string{}}}
+	} else {
+		operation["security"] = []Document{}
+	}
+
+	return operation, scheme, schemeName
+}
+
+var nonWord = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func operationId(resourceName, method, path string) string {
+	words := strings.Trim(nonWord.ReplaceAllString(path, "-"), "-")
+	if words == "" {
+		words = "root"
+	}
+	return resourceName + "-" + strings.ToLower(method) + "-" + words
+}
+
+func methodKey(method string) string {
+	if method == "ANY" {
+		return "x-amazon-apigateway-any-method"
+	}
+	return strings.ToLower(method)
+}
+
+func pathParameters(path string) []Document {
+	var parameters []Document
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			parameters = append(parameters, Document{
+				"name":     strings.Trim(segment, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   Document{"type": "string"},
+			})
+		}
+	}
+	return parameters
+}
+
+func readFragment(functionPath string) (Document, error) {
+	fragment := Document{}
+
+	content, err := os.ReadFile(filepath.Join(functionPath, Fragment))
+	if os.IsNotExist(err) {
+		return fragment, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(content, &fragment); err != nil {
+		return nil, err
+	}
+
+	return fragment, nil
+}
+
+func child(parent Document, key string) Document {
+	if existing, ok := parent[key].(Document); ok {
+		return existing
+	}
+
+	created := Document{}
+	parent[key] = created
+	return created
+}
+
+// merge deep merges src into dst, values from src win.
+func merge(dst, src Document) {
+	for key, value := range src {
+		if srcChild, ok := value.(Document); ok {
+			if dstChild, ok := dst[key].(Document); ok {
+				merge(dstChild, srcChild)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
@@ -0,0 +1,228 @@
+package permission
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/convention/deployment"
+	"github.com/linecard/self/pkg/service/event"
+	"github.com/linecard/self/pkg/service/function"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+)
+
+type FunctionService interface {
+	ListPermissions(ctx context.Context, functionName string) ([]function.Permission, error)
+	AddPermission(ctx context.Context, functionName string, permission function.Permission) error
+	RemovePermission(ctx context.Context, functionName, sid string) error
+}
+
+type GatewayService interface {
+	GetApis(ctx context.Context) (*apigatewayv2.GetApisOutput, error)
+	GetRoutesByFunctionArn(ctx context.Context, apiId, functionArn string) ([]types.Route, error)
+	GetAuthorizerByName(ctx context.Context, apiId, name string) (*types.Authorizer, error)
+}
+
+type EventService interface {
+	ListByTarget(ctx context.Context, targetArn string) ([]event.JoinedRule, error)
+}
+
+type Services struct {
+	Function FunctionService
+	Gateway  GatewayService
+	Event    EventService
+}
+
+type Convention struct {
+	Config  config.Config
+	Service Services
+}
+
+func FromServices(c config.Config, f FunctionService, g GatewayService, e EventService) Convention {
+	return Convention{
+		Config: c,
+		Service: Services{
+			Function: f,
+			Gateway:  g,
+			Event:    e,
+		},
+	}
+}
+
+// Converge reconciles the function's resource policy with the routes, authorizers and bus rules that invoke it.
+// Only statements self manages are touched: those prefixed "self-" or with the function name, and the
+// "-" statement left behind by earlier releases.
+func (c Convention) Converge(ctx context.Context, d deployment.Deployment) error {
+	ctx, span := otel.Tracer("").Start(ctx, "permission.converge")
+	defer span.End()
+
+	functionName := *d.Configuration.FunctionName
+
+	desired, err := c.Desired(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	actual, err := c.Service.Function.ListPermissions(ctx, functionName)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]function.Permission)
+	for _, permission := range desired {
+		wanted[permission.Sid] = permission
+	}
+
+	for _, permission := range actual {
+		if !c.managed(functionName, permission.Sid) {
+			continue
+		}
+
+		if want, ok := wanted[permission.Sid]; ok && want == permission {
+			delete(wanted, permission.Sid)
+			continue
+		}
+
+		log.Info().Msgf("removing permission %s from %s", permission.Sid, functionName)
+		if err := c.Service.Function.RemovePermission(ctx, functionName, permission.Sid); err != nil {
+			return err
+		}
+	}
+
+	for _, permission := range desired {
+		if _, ok := wanted[permission.Sid]; !ok {
+			continue
+		}
+
+		log.Info().Msgf("adding permission %s to %s", permission.Sid, functionName)
+		if err := c.Service.Function.AddPermission(ctx, functionName, permission); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Desired lists the invoke permissions the function needs for what is currently wired to it.
+func (c Convention) Desired(ctx context.Context, d deployment.Deployment) ([]function.Permission, error) {
+	var permissions []function.Permission
+
+	functionName := *d.Configuration.FunctionName
+	functionArn := *d.Configuration.FunctionArn
+
+	apis, err := c.Service.Gateway.GetApis(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, api := range apis.Items {
+		if !c.Config.ApiGateway.Manages(api) {
+			continue
+		}
+
+		routes, err := c.Service.Gateway.GetRoutesByFunctionArn(ctx, *api.ApiId, functionArn)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, route := range routes {
+			source, ok := routeSource(*route.RouteKey)
+			if !ok {
+				log.Warn().Msgf("skipping permission for route %s of api %s, its key is not \"METHOD /path\"", *route.RouteKey, *api.ApiId)
+				continue
+			}
+
+			permissions = append(permissions, function.Permission{
+				Sid:       statementId("self-" + *api.ApiId + "-" + *route.RouteKey),
+				Principal: "apigateway.amazonaws.com",
+				SourceArn: executeApiArn(functionArn, *api.ApiId, source),
+			})
+		}
+
+		authorizer, err := c.Service.Gateway.GetAuthorizerByName(ctx, *api.ApiId, functionName)
+		if err != nil {
+			return nil, err
+		}
+
+		if authorizer != nil && strings.Contains(aws.ToString(authorizer.AuthorizerUri), functionArn) {
+			permissions = append(permissions, function.Permission{
+				Sid:       statementId("self-authorizer-" + *api.ApiId),
+				Principal: "apigateway.amazonaws.com",
+				SourceArn: executeApiArn(functionArn, *api.ApiId, "authorizers/"+*authorizer.AuthorizerId),
+			})
+		}
+	}
+
+	rules, err := c.Service.Event.ListByTarget(ctx, functionArn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		// Statement ids match those granted by the event service when enabling a subscription.
+		permissions = append(permissions, function.Permission{
+			Sid:       *rule.Rule.Name,
+			Principal: "events.amazonaws.com",
+			SourceArn: *rule.Rule.Arn,
+		})
+	}
+
+	return permissions, nil
+}
+
+func (c Convention) managed(functionName, sid string) bool {
+	return sid == "-" || strings.HasPrefix(sid, "self-") || strings.HasPrefix(sid, functionName+"-")
+}
+
+// routeSource maps a route key onto the stage/method/path part of an execute-api arn,
+// with path parameters widened to wildcards, e.g. "GET /fn/{id}" becomes "*/GET/fn/*".
+// The $default route catches any method and path, other keys without a path are not mapped.
+func routeSource(routeKey string) (string, bool) {
+	if routeKey == "$default" {
+		return "*/*", true
+	}
+
+	method, path, found := strings.Cut(routeKey, " ")
+	if !found {
+		return "", false
+	}
+
+	if method == "ANY" {
+		method = "*"
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = "*"
+		}
+	}
+
+	return "*/" + method + "/" + strings.Join(segments, "/"), true
+}
+
+func executeApiArn(functionArn, apiId, source string) string {
+	parts := strings.Split(functionArn, ":")
+	return "arn:aws:execute-api:" + parts[3] + ":" + parts[4] + ":" + apiId + "/" + source
+}
+
+var invalidSid = regexp.MustCompile(`[^a-zA-Z0-9-_.]+`)
+
+// Statement ids are limited to 100 characters of [a-zA-Z0-9-_.], long ones keep a hash for uniqueness.
+func statementId(raw string) string {
+	sid := strings.Trim(invalidSid.ReplaceAllString(raw, "-"), "-")
+	if len(sid) <= 100 {
+		return sid
+	}
+
+	sum := sha1.Sum([]byte(raw))
+	return sid[:91] + "-" + hex.EncodeToString(sum[:])[:8]
+}
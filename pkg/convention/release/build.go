@@ -0,0 +1,87 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/service/docker"
+)
+
+// CacheTag tags the build cache in each function's repository. It is never listed as a release.
+const CacheTag = "buildcache"
+
+// BuildOptions are build settings from the command line, merged over the "build" section of resources.json.
+type BuildOptions struct {
+	// Args are KEY=VALUE build arguments.
+	Args []string
+	// Secrets are BuildKit secret specs, e.g. "id=npm,env=NPM_TOKEN" or "id=netrc,src=.netrc".
+	Secrets []string
+	Ssh     bool
+	Cache   bool
+}
+
+// withBuildSettings fills the build arguments, secrets, ssh forwarding and cache of the input.
+// Argument values are templated, and relative secret files in resources.json are relative to the function.
+func (c Convention) withBuildSettings(input docker.BuildInput, buildtime config.BuildTime, o BuildOptions) (docker.BuildInput, error) {
+	settings := config.ComputedBuild{}
+	if buildtime.Computed.Resources.Build != nil {
+		settings = *buildtime.Computed.Resources.Build
+	}
+
+	input.BuildArgs = make(map[string]string)
+	for key, value := range settings.Args {
+		input.BuildArgs[key] = value
+	}
+
+	for _, arg := range o.Args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			// Like docker, a bare key passes the variable through from the environment.
+			value = os.Getenv(key)
+		}
+		input.BuildArgs[key] = value
+	}
+
+	for key, value := range input.BuildArgs {
+		templated, err := c.Config.Template(value)
+		if err != nil {
+			return input, fmt.Errorf("build arg %s: %w", key, err)
+		}
+		input.BuildArgs[key] = templated
+	}
+
+	for _, secret := range settings.Secrets {
+		if secret.Id == "" || (secret.Env == "") == (secret.Src == "") {
+			return input, fmt.Errorf("build secret %q needs an id and exactly one of env or src", secret.Id)
+		}
+
+		if secret.Env != "" {
+			input.Secrets = append(input.Secrets, "id="+secret.Id+",env="+secret.Env)
+			continue
+		}
+
+		src := secret.Src
+		if strings.HasPrefix(src, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return input, err
+			}
+			src = filepath.Join(home, src[2:])
+		} else if !filepath.IsAbs(src) {
+			src = filepath.Join(input.FunctionPath, src)
+		}
+		input.Secrets = append(input.Secrets, "id="+secret.Id+",src="+src)
+	}
+
+	input.Secrets = append(input.Secrets, o.Secrets...)
+	input.Ssh = settings.Ssh || o.Ssh
+
+	if settings.Cache || o.Cache {
+		input.Cache = buildtime.Computed.Repository.Url + ":" + CacheTag
+	}
+
+	return input, nil
+}
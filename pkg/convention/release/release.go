@@ -2,12 +2,24 @@ package release
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/linecard/self/internal/util"
 	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/convention/manifest"
+	"github.com/linecard/self/pkg/convention/openapi"
+	"github.com/linecard/self/pkg/service/bundle"
+	"github.com/linecard/self/pkg/service/docker"
+	"github.com/linecard/self/pkg/service/registry"
+	"github.com/linecard/self/pkg/service/signing"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 
@@ -15,35 +27,65 @@ import (
 	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/aws/smithy-go"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/golang-module/carbon/v2"
+	"github.com/rs/zerolog/log"
 )
 
-type RegistryService interface {
+// Store holds releases, it is either the registry or, for zip packages, the package bucket.
+type Store interface {
 	InspectByTag(ctx context.Context, registryId, repositoryName, tag string) (types.ImageInspect, error)
+	InspectByDigest(ctx context.Context, registryId, repositoryName, digest string) (types.ImageInspect, error)
 	ImageUri(ctx context.Context, registryId, registryUrl, repositoryName, tag string) (string, error)
+	Digest(ctx context.Context, registryId, repositoryName, tag string) (string, error)
 	List(ctx context.Context, registryId, repositoryName string) (ecr.DescribeImagesOutput, error)
 	Delete(ctx context.Context, registryId, repositoryName string, imageDigests []string) error
 	Untag(ctx context.Context, registryId, repositoryName, tag string) error
 	PutRepository(ctx context.Context, repositoryName string) error
+	PutSignature(ctx context.Context, registryId, registryUrl, repositoryName, digest string, signature []byte) error
+	DeleteSignature(ctx context.Context, registryId, repositoryName, digest string) error
+}
+
+type RegistryService interface {
+	Store
+	PushArchive(ctx context.Context, registryId, registryUrl, repositoryName, path string, labels map[string]string, tags []string) (string, error)
+}
+
+type PackageService interface {
+	Store
+	Exists(ctx context.Context, repositoryName string) (bool, error)
+	Zip(ctx context.Context, i bundle.ZipInput) error
+	Push(ctx context.Context, repositoryName, path string, sidecar bundle.Sidecar, tags []string) (string, error)
 }
 
 type BuildService interface {
 	InspectByTag(ctx context.Context, registryUrl, repository, tag string) (types.ImageInspect, error)
-	Build(ctx context.Context, functionPath, contextPath string, labels map[string]string, tags []string) error
+	Build(ctx context.Context, i docker.BuildInput) error
 	Push(ctx context.Context, tag string) error
 }
 
+type SigningService interface {
+	Sign(ctx context.Context, key string, payload []byte) (signing.Signature, error)
+}
+
 type EventService interface {
 	Emit(ctx context.Context, accountId, busName, detailType string, detail any) error
 }
 
 type Image struct {
 	types.ImageInspect
+	// Archive is set when the builder wrote an OCI archive instead of a local image, Publish pushes it directly.
+	Archive string
+	// Zip is set for zip packaged functions, Publish uploads it to the package bucket.
+	Zip string
 }
 
 type Release struct {
 	Image
-	Uri             string
+	// Uri is what Lambda deploys, the platform image of a multi-platform release.
+	Uri string
+	// Digest is what the release was tagged and signed under, the index of a multi-platform release.
+	Digest          string
 	AWSArchitecture []lambdatypes.Architecture
 }
 
@@ -52,12 +94,24 @@ type ReleaseSummary struct {
 	GitSha      string
 	ImageDigest string
 	Released    string
+	Provenance  Provenance
+}
+
+// Provenance is who and what produced a release, read from its labels by Describe.
+type Provenance struct {
+	Author      string
+	Subject     string
+	Committed   string
+	RunUrl      string
+	SelfVersion string
 }
 
 type Service struct {
 	Registry RegistryService
+	Package  PackageService
 	Build    BuildService
 	Event    EventService
+	Signing  SigningService
 }
 
 type Convention struct {
@@ -65,16 +119,32 @@ type Convention struct {
 	Service Service
 }
 
-func FromServices(c config.Config, r RegistryService, b BuildService) Convention {
+func FromServices(c config.Config, r RegistryService, p PackageService, b BuildService, s SigningService) Convention {
 	return Convention{
 		Config: c,
 		Service: Service{
 			Registry: r,
+			Package:  p,
 			Build:    b,
+			Signing:  s,
 		},
 	}
 }
 
+// store picks the package bucket for repositories published there, and the registry otherwise.
+func (c Convention) store(ctx context.Context, repositoryName string) (Store, error) {
+	packaged, err := c.Service.Package.Exists(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+
+	if packaged {
+		return c.Service.Package, nil
+	}
+
+	return c.Service.Registry, nil
+}
+
 func (c Convention) Find(ctx context.Context, repositoryName, tag string) (Release, error) {
 	ctx, span := otel.Tracer("").Start(ctx, "find")
 	defer span.End()
@@ -86,12 +156,22 @@ func (c Convention) Find(ctx context.Context, repositoryName, tag string) (Relea
 		attribute.String("tag", tag),
 	)
 
-	inspect, err := c.Service.Registry.InspectByTag(ctx, c.Config.Registry.Id, repositoryName, tag)
+	store, err := c.store(ctx, repositoryName)
 	if err != nil {
 		return Release{}, err
 	}
 
-	uri, err := c.Service.Registry.ImageUri(ctx, c.Config.Registry.Id, c.Config.Registry.Url, repositoryName, tag)
+	inspect, err := store.InspectByTag(ctx, c.Config.Registry.Id, repositoryName, tag)
+	if err != nil {
+		return Release{}, err
+	}
+
+	uri, err := store.ImageUri(ctx, c.Config.Registry.Id, c.Config.Registry.Url, repositoryName, tag)
+	if err != nil {
+		return Release{}, err
+	}
+
+	digest, err := store.Digest(ctx, c.Config.Registry.Id, repositoryName, tag)
 	if err != nil {
 		return Release{}, err
 	}
@@ -115,14 +195,19 @@ func (c Convention) Find(ctx context.Context, repositoryName, tag string) (Relea
 		attribute.String("image-uri", uri),
 	)
 
-	return Release{Image{inspect}, uri, awsArch}, nil
+	return Release{Image{ImageInspect: inspect}, uri, digest, awsArch}, nil
 }
 
 func (c Convention) List(ctx context.Context, repositoryName string) ([]ReleaseSummary, error) {
 	var releases []ReleaseSummary
 	var apiErr smithy.APIError
 
-	list, err := c.Service.Registry.List(ctx, c.Config.Registry.Url, repositoryName)
+	store, err := c.store(ctx, repositoryName)
+	if err != nil {
+		return []ReleaseSummary{}, err
+	}
+
+	list, err := store.List(ctx, c.Config.Registry.Url, repositoryName)
 	if errors.As(err, &apiErr) {
 		switch apiErr.ErrorCode() {
 		case "RepositoryNotFoundException":
@@ -133,6 +218,10 @@ func (c Convention) List(ctx context.Context, repositoryName string) ([]ReleaseS
 	}
 
 	for _, image := range list.ImageDetails {
+		if slices.Contains(image.ImageTags, CacheTag) || slices.ContainsFunc(image.ImageTags, registry.IsSignatureTag) {
+			continue
+		}
+
 		summary := ReleaseSummary{}
 		summary.ImageDigest = string(*image.ImageDigest)
 		summary.Released = image.ImagePushedAt.String()
@@ -149,7 +238,52 @@ func (c Convention) List(ctx context.Context, repositoryName string) ([]ReleaseS
 	return releases, nil
 }
 
-func (c Convention) Build(ctx context.Context, path, context string) (Image, config.BuildTime, error) {
+// Describe reads the provenance of each release from its labels. Releases that cannot be read,
+// or were published before provenance was recorded, are left without.
+func (c Convention) Describe(ctx context.Context, repositoryName string, releases []ReleaseSummary) ([]ReleaseSummary, error) {
+	ctx, span := otel.Tracer("").Start(ctx, "describe")
+	defer span.End()
+
+	store, err := c.store(ctx, repositoryName)
+	if err != nil {
+		return releases, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(releases))
+
+	for i := range releases {
+		go func(release *ReleaseSummary) {
+			defer wg.Done()
+
+			digest := strings.TrimPrefix(release.ImageDigest, "sha256:")
+			inspect, err := store.InspectByDigest(ctx, c.Config.Registry.Id, repositoryName, digest)
+			if err != nil || inspect.Config == nil {
+				log.Warn().Err(err).Msgf("failed to describe release %s", release.ImageDigest)
+				return
+			}
+
+			deploytime, err := c.Config.DeployTime(inspect.Config.Labels)
+			if err != nil {
+				log.Warn().Err(err).Msgf("failed to describe release %s", release.ImageDigest)
+				return
+			}
+
+			release.Provenance = Provenance{
+				Author:      deploytime.Author.Decoded,
+				Subject:     deploytime.Subject.Decoded,
+				Committed:   deploytime.Committed.Decoded,
+				RunUrl:      deploytime.RunUrl.Decoded,
+				SelfVersion: deploytime.Version.Decoded,
+			}
+		}(&releases[i])
+	}
+
+	wg.Wait()
+	return releases, nil
+}
+
+func (c Convention) Build(ctx context.Context, path, context string, o BuildOptions) (Image, config.BuildTime, error) {
 	ctx, span := otel.Tracer("").Start(ctx, "build")
 	defer span.End()
 
@@ -158,6 +292,10 @@ func (c Convention) Build(ctx context.Context, path, context string) (Image, con
 		return Image{}, buildtime, err
 	}
 
+	if buildtime, err = withOpenApi(buildtime, path); err != nil {
+		return Image{}, buildtime, err
+	}
+
 	tags := []string{ // make this a part of computed.
 		fmt.Sprintf("%s:%s",
 			buildtime.Computed.Repository.Url,
@@ -179,18 +317,39 @@ func (c Convention) Build(ctx context.Context, path, context string) (Image, con
 		attribute.StringSlice("tags", tags),
 	)
 
-	err = c.Service.Build.Build(
-		ctx,
-		path,
-		context,
-		buildtime.EncodedLabels(),
-		tags,
-	)
+	input := docker.BuildInput{
+		FunctionPath: path,
+		ContextPath:  context,
+		Labels:       buildtime.EncodedLabels(),
+		Tags:         tags,
+		Platform:     c.Config.Builder.Platform,
+	}
 
-	if err != nil {
+	if buildtime.Computed.Resources.Package == "zip" {
+		image, err := c.buildZip(ctx, path, buildtime, tags)
+		return image, buildtime, err
+	}
+
+	if input, err = c.withBuildSettings(input, buildtime, o); err != nil {
 		return Image{}, buildtime, err
 	}
 
+	if c.Config.Builder.Archives() {
+		input.Output = filepath.Join(os.TempDir(), fmt.Sprintf("self-%s-%s.tar", buildtime.Computed.Resource.Name, buildtime.Sha.Decoded))
+	}
+
+	if err = c.Service.Build.Build(ctx, input); err != nil {
+		return Image{}, buildtime, err
+	}
+
+	if input.Output != "" {
+		inspect := types.ImageInspect{
+			RepoTags: tags,
+			Config:   &container.Config{Labels: input.Labels},
+		}
+		return Image{ImageInspect: inspect, Archive: input.Output}, buildtime, nil
+	}
+
 	inspect, err := c.Service.Build.InspectByTag(
 		ctx,
 		buildtime.Computed.Registry.Url,
@@ -202,7 +361,7 @@ func (c Convention) Build(ctx context.Context, path, context string) (Image, con
 		return Image{}, buildtime, err
 	}
 
-	return Image{inspect}, buildtime, nil
+	return Image{ImageInspect: inspect}, buildtime, nil
 }
 
 func (c Convention) Publish(ctx context.Context, i Image) error {
@@ -223,13 +382,215 @@ func (c Convention) Publish(ctx context.Context, i Image) error {
 		return fmt.Errorf("image must have exactly two tags, was given %d, try deleting local images", len(i.RepoTags))
 	}
 
+	repositoryName, tags, err := c.splitTags(i.RepoTags)
+	if err != nil {
+		return err
+	}
+
+	var store Store = c.Service.Registry
+	if i.Zip != "" {
+		store = c.Service.Package
+	}
+
+	if err := c.checkLimits(i.Config.Labels); err != nil {
+		return err
+	}
+
+	if err := c.guardShaTag(ctx, store, repositoryName, i.Config.Labels); err != nil {
+		return err
+	}
+
+	var digest string
+
+	switch {
+	case i.Archive != "":
+		digest, err = c.publishArchive(ctx, i)
+	case i.Zip != "":
+		digest, err = c.publishZip(ctx, i)
+	default:
+		digest, err = c.pushImage(ctx, i, repositoryName, tags[0])
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.sign(ctx, store, repositoryName, digest, i.Config.Labels)
+}
+
+// pushImage pushes a local image with docker, returning the digest the registry knows it by.
+func (c Convention) pushImage(ctx context.Context, i Image, repositoryName, tag string) (string, error) {
 	for _, tag := range i.RepoTags {
 		if err := c.Service.Build.Push(ctx, tag); err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	return nil
+	return c.Service.Registry.Digest(ctx, c.Config.Registry.Id, repositoryName, tag)
+}
+
+// checkLimits renders the release as it would deploy to this account, so policies and rules too large for
+// IAM or EventBridge fail at publish rather than at deploy time.
+func (c Convention) checkLimits(labels map[string]string) error {
+	deploytime, err := c.Config.DeployTime(labels)
+	if err != nil {
+		return err
+	}
+
+	return deploytime.Validate()
+}
+
+// sign signs a published release and stores the signature beside it, when a signing key is configured.
+func (c Convention) sign(ctx context.Context, store Store, repositoryName, digest string, labels map[string]string) error {
+	if c.Config.Signing.Key == "" {
+		return nil
+	}
+
+	payload, err := manifest.Payload(digest, labels)
+	if err != nil {
+		return err
+	}
+
+	signature, err := c.Service.Signing.Sign(ctx, c.Config.Signing.Key, payload)
+	if err != nil {
+		return fmt.Errorf("signing %s: %w", digest, err)
+	}
+
+	content, err := json.Marshal(signature)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("signed %s@%s with %s", repositoryName, digest, signature.KeyId)
+	return store.PutSignature(ctx, c.Config.Registry.Id, c.Config.Registry.Url, repositoryName, digest, content)
+}
+
+// publishArchive pushes an image the builder left as an OCI archive, its labels were set at build time.
+func (c Convention) publishArchive(ctx context.Context, i Image) (string, error) {
+	repositoryName, tags, err := c.splitTags(i.RepoTags)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := c.Service.Registry.PushArchive(ctx, c.Config.Registry.Id, c.Config.Registry.Url, repositoryName, i.Archive, nil, tags)
+	if err != nil {
+		return "", err
+	}
+
+	return digest, os.Remove(i.Archive)
+}
+
+// guardShaTag refuses to publish over a sha tag already in the repository, when sha tags are immutable.
+// Branch tags move with every publish and are never guarded.
+func (c Convention) guardShaTag(ctx context.Context, store Store, repositoryName string, labels map[string]string) error {
+	if !c.Config.Repositories.ImmutableShaTags {
+		return nil
+	}
+
+	deploytime, err := c.Config.DeployTime(labels)
+	if err != nil {
+		return err
+	}
+
+	var apiErr smithy.APIError
+	_, err = store.InspectByTag(ctx, c.Config.Registry.Id, repositoryName, deploytime.Sha.Decoded)
+
+	switch {
+	case err == nil:
+		return fmt.Errorf("%s:%s is already published and sha tags are immutable, commit to publish a new release", repositoryName, deploytime.Sha.Decoded)
+	case errors.As(err, &apiErr) && (apiErr.ErrorCode() == "ImageNotFoundException" || apiErr.ErrorCode() == "RepositoryNotFoundException"):
+		return nil
+	default:
+		return err
+	}
+}
+
+// splitTags splits image references into their repository and tags.
+func (c Convention) splitTags(refs []string) (string, []string, error) {
+	var repositoryName string
+	var tags []string
+
+	for _, ref := range refs {
+		repository, tag, found := strings.Cut(strings.TrimPrefix(ref, c.Config.Registry.Url+"/"), ":")
+		if !found {
+			return "", nil, fmt.Errorf("image reference %s has no tag", ref)
+		}
+		repositoryName = repository
+		tags = append(tags, tag)
+	}
+
+	return repositoryName, tags, nil
+}
+
+// PublishArchive pushes an image built elsewhere, as an OCI layout or tarball, straight to the registry without docker.
+// The release labels are stamped onto the image on the way, so any builder will do.
+func (c Convention) PublishArchive(ctx context.Context, path, archive string) (config.BuildTime, error) {
+	ctx, span := otel.Tracer("").Start(ctx, "publish-archive")
+	defer span.End()
+
+	buildtime, err := c.Config.BuildTime(path)
+	if err != nil {
+		return buildtime, err
+	}
+
+	if buildtime, err = withOpenApi(buildtime, path); err != nil {
+		return buildtime, err
+	}
+
+	tags := []string{
+		buildtime.Branch.Decoded,
+		buildtime.Sha.Decoded,
+	}
+
+	span.SetAttributes(
+		attribute.String("archive", archive),
+		attribute.String("repository-name", buildtime.Computed.Repository.Name),
+		attribute.StringSlice("tags", tags),
+	)
+
+	if err := c.checkLimits(buildtime.EncodedLabels()); err != nil {
+		return buildtime, err
+	}
+
+	if err := c.guardShaTag(ctx, c.Service.Registry, buildtime.Computed.Repository.Name, buildtime.EncodedLabels()); err != nil {
+		return buildtime, err
+	}
+
+	digest, err := c.Service.Registry.PushArchive(
+		ctx,
+		c.Config.Registry.Id,
+		c.Config.Registry.Url,
+		buildtime.Computed.Repository.Name,
+		archive,
+		buildtime.EncodedLabels(),
+		tags,
+	)
+
+	if err != nil {
+		return buildtime, err
+	}
+
+	span.SetAttributes(attribute.String("image-digest", digest))
+
+	err = c.sign(ctx, c.Service.Registry, buildtime.Computed.Repository.Name, digest, buildtime.EncodedLabels())
+	return buildtime, err
+}
+
+// withOpenApi labels the release with the OpenAPI document of the function's routes, so consumers of
+// the api can read it from the published image.
+func withOpenApi(buildtime config.BuildTime, path string) (config.BuildTime, error) {
+	document, err := openapi.Function(buildtime, path)
+	if err != nil || document == nil {
+		return buildtime, err
+	}
+
+	content, err := json.Marshal(document)
+	if err != nil {
+		return buildtime, err
+	}
+
+	err = buildtime.OpenApi.EncodeJson(content)
+	return buildtime, err
 }
 
 func (c Convention) Untag(ctx context.Context, repositoryName, tag string) error {
@@ -243,7 +604,12 @@ func (c Convention) Untag(ctx context.Context, repositoryName, tag string) error
 		attribute.String("tag", tag),
 	)
 
-	return c.Service.Registry.Untag(ctx, c.Config.Registry.Id, repositoryName, tag)
+	store, err := c.store(ctx, repositoryName)
+	if err != nil {
+		return err
+	}
+
+	return store.Untag(ctx, c.Config.Registry.Id, repositoryName, tag)
 }
 
 func (c Convention) EnsureRepository(ctx context.Context, repositoryName string) error {
@@ -277,5 +643,20 @@ func (c Convention) GcPlan(ctx context.Context, repositoryName string) ([]Releas
 }
 
 func (c Convention) GcApply(ctx context.Context, repositoryName string, digests []string) error {
-	return c.Service.Registry.Delete(ctx, c.Config.Registry.Id, repositoryName, digests)
+	store, err := c.store(ctx, repositoryName)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Delete(ctx, c.Config.Registry.Id, repositoryName, digests); err != nil {
+		return err
+	}
+
+	for _, digest := range digests {
+		if err := store.DeleteSignature(ctx, c.Config.Registry.Id, repositoryName, digest); err != nil {
+			log.Warn().Err(err).Msgf("failed to delete signature of %s", digest)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,83 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/service/bundle"
+)
+
+// buildZip packages a function without a Dockerfile. The result is described like an image,
+// labelled with the release manifest, so it is published and deployed through the same paths.
+func (c Convention) buildZip(ctx context.Context, path string, buildtime config.BuildTime, tags []string) (Image, error) {
+	resources := buildtime.Computed.Resources
+	if resources.Runtime == "" || resources.Handler == "" {
+		return Image{}, fmt.Errorf("zip package %s needs a runtime and handler in resources.json", buildtime.Name.Decoded)
+	}
+
+	output := filepath.Join(os.TempDir(), fmt.Sprintf("self-%s-%s.zip", buildtime.Computed.Resource.Name, buildtime.Sha.Decoded))
+
+	input := bundle.ZipInput{
+		FunctionPath: path,
+		Runtime:      resources.Runtime,
+		Output:       output,
+	}
+
+	if err := c.Service.Package.Zip(ctx, input); err != nil {
+		return Image{}, err
+	}
+
+	architecture := "amd64"
+	if c.Config.Registry.Architecture != "" {
+		architecture = c.Config.Registry.Architecture
+	}
+
+	inspect := types.ImageInspect{
+		RepoTags:     tags,
+		Architecture: architecture,
+		Os:           "linux",
+		Config: &container.Config{
+			Labels:     buildtime.EncodedLabels(),
+			Entrypoint: []string{resources.Runtime},
+			Cmd:        []string{resources.Handler},
+		},
+	}
+
+	return Image{ImageInspect: inspect, Zip: output}, nil
+}
+
+func (c Convention) publishZip(ctx context.Context, i Image) (string, error) {
+	repositoryName, tags, err := c.splitTags(i.RepoTags)
+	if err != nil {
+		return "", err
+	}
+
+	sidecar := bundle.Sidecar{
+		Architecture: i.Architecture,
+		Runtime:      i.Config.Entrypoint[0],
+		Handler:      i.Config.Cmd[0],
+		Labels:       i.Config.Labels,
+	}
+
+	digest, err := c.Service.Package.Push(ctx, repositoryName, i.Zip, sidecar, tags)
+	if err != nil {
+		return "", err
+	}
+
+	return digest, os.Remove(i.Zip)
+}
+
+// ZipPackage reports whether the release is a zip package, and the runtime and handler it runs with.
+func (r Release) ZipPackage() (runtime, handler string, ok bool) {
+	if !strings.HasPrefix(r.Uri, "s3://") || r.Config == nil || len(r.Config.Entrypoint) == 0 || len(r.Config.Cmd) == 0 {
+		return "", "", false
+	}
+
+	return r.Config.Entrypoint[0], r.Config.Cmd[0], true
+}
@@ -0,0 +1,303 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gin-gonic/gin"
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/service/gateway"
+	"github.com/rs/zerolog/log"
+)
+
+// Upstream is a route served by an emulated function listening on the given port.
+type Upstream struct {
+	Route config.ComputedRoute
+	Port  int
+}
+
+// Proxy emulates the API gateway in front of emulated functions, translating requests
+// into payload format 2.0 events with the same path rewrites as the deployed integrations.
+// Authorization is not emulated.
+func (c Convention) Proxy(upstreams []Upstream) *gin.Engine {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	router.NoRoute(func(ctx *gin.Context) {
+		upstream, params, found := matchRoute(ctx.Request.Method, ctx.Request.URL.Path, upstreams)
+		if !found {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Not Found"})
+			return
+		}
+
+		event, err := proxyEvent(ctx.Request, upstream.Route, params, c.Config.Account.Id)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		response, err := invoke(client, upstream.Port, event)
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to invoke %s", upstream.Route.RouteKey)
+			ctx.JSON(http.StatusBadGateway, gin.H{"message": "Internal Server Error"})
+			return
+		}
+
+		writeResponse(ctx, response)
+	})
+
+	return router
+}
+
+// matchRoute picks the most specific route matching the request, as the gateway does:
+// literal segments beat path parameters, which beat greedy parameters, and methods beat ANY.
+func matchRoute(method, path string, upstreams []Upstream) (Upstream, map[string]string, bool) {
+	type candidate struct {
+		upstream Upstream
+		params   map[string]string
+		score    []int
+	}
+
+	var candidates []candidate
+
+	for _, upstream := range upstreams {
+		routeMethod, routePath, found := strings.Cut(upstream.Route.RouteKey, " ")
+		if !found || (routeMethod != "ANY" && routeMethod != method) {
+			continue
+		}
+
+		params, score, ok := matchPath(routePath, path)
+		if !ok {
+			continue
+		}
+
+		methodScore := 0
+		if routeMethod != "ANY" {
+			methodScore = 1
+		}
+
+		candidates = append(candidates, candidate{upstream, params, append(score, methodScore)})
+	}
+
+	if len(candidates) == 0 {
+		return Upstream{}, nil, false
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		for k := range candidates[i].score {
+			if candidates[i].score[k] != candidates[j].score[k] {
+				return candidates[i].score[k] > candidates[j].score[k]
+			}
+		}
+		return false
+	})
+
+	return candidates[0].upstream, candidates[0].params, true
+}
+
+func matchPath(routePath, path string) (map[string]string, []int, bool) {
+	params := make(map[string]string)
+	routeSegments := strings.Split(strings.Trim(routePath, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	literals, greedy := 0, 0
+
+	for i, segment := range routeSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "+}") {
+			if i >= len(pathSegments) || pathSegments[i] == "" {
+				return nil, nil, false
+			}
+			params[strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "+}")] = strings.Join(pathSegments[i:], "/")
+			greedy = 1
+			return params, []int{-greedy, literals, len(routeSegments)}, true
+		}
+
+		if i >= len(pathSegments) {
+			return nil, nil, false
+		}
+
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[strings.Trim(segment, "{}")] = pathSegments[i]
+			continue
+		}
+
+		if segment != pathSegments[i] {
+			return nil, nil, false
+		}
+
+		literals++
+	}
+
+	if len(routeSegments) != len(pathSegments) {
+		return nil, nil, false
+	}
+
+	return params, []int{-greedy, literals, len(routeSegments)}, true
+}
+
+// rewritePath applies the integration's overwrite:path mapping to the matched path parameters.
+func rewritePath(route config.ComputedRoute, params map[string]string) string {
+	path := gateway.IntegrationPath(route.RouteKey, route.Prefix)
+	for name, value := range params {
+		path = strings.ReplaceAll(path, "$request.path."+name, value)
+	}
+	return path
+}
+
+func proxyEvent(r *http.Request, route config.ComputedRoute, params map[string]string, accountId string) (events.APIGatewayV2HTTPRequest, error) {
+	now := time.Now()
+	path := rewritePath(route, params)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return events.APIGatewayV2HTTPRequest{}, err
+	}
+
+	headers := make(map[string]string)
+	for name, values := range r.Header {
+		if strings.EqualFold(name, "Cookie") {
+			continue
+		}
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	headers["x-forwarded-prefix"] = route.ForwardedPrefix
+
+	query := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		query[name] = strings.Join(values, ",")
+	}
+
+	var cookies []string
+	for _, cookie := range r.Cookies() {
+		cookies = append(cookies, cookie.String())
+	}
+
+	sourceIp, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIp = r.RemoteAddr
+	}
+
+	event := events.APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RouteKey:              route.RouteKey,
+		RawPath:               path,
+		RawQueryString:        r.URL.RawQuery,
+		Cookies:               cookies,
+		Headers:               headers,
+		QueryStringParameters: query,
+		PathParameters:        params,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:   route.RouteKey,
+			AccountID:  accountId,
+			Stage:      "$default",
+			RequestID:  fmt.Sprintf("local-%d", now.UnixNano()),
+			APIID:      "local",
+			DomainName: r.Host,
+			Time:       now.Format("02/Jan/2006:15:04:05 -0700"),
+			TimeEpoch:  now.UnixMilli(),
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    r.Method,
+				Path:      path,
+				Protocol:  r.Proto,
+				SourceIP:  sourceIp,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}
+
+	if len(body) > 0 {
+		if utf8.Valid(body) {
+			event.Body = string(body)
+		} else {
+			event.Body = base64.StdEncoding.EncodeToString(body)
+			event.IsBase64Encoded = true
+		}
+	}
+
+	return event, nil
+}
+
+func invoke(client *http.Client, port int, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	url := fmt.Sprintf("http://localhost:%d/2015-03-31/functions/function/invocations", port)
+	res, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	return parseResponse(raw), nil
+}
+
+// Payload format 2.0 treats anything without a statusCode as a 200 JSON body.
+func parseResponse(raw []byte) events.APIGatewayV2HTTPResponse {
+	var probe map[string]json.RawMessage
+	var response events.APIGatewayV2HTTPResponse
+
+	if json.Unmarshal(raw, &probe) == nil {
+		if _, ok := probe["statusCode"]; ok && json.Unmarshal(raw, &response) == nil {
+			return response
+		}
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"content-type": "application/json"},
+		Body:       string(raw),
+	}
+}
+
+func writeResponse(ctx *gin.Context, response events.APIGatewayV2HTTPResponse) {
+	for name, value := range response.Headers {
+		ctx.Header(name, value)
+	}
+
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			ctx.Writer.Header().Add(name, value)
+		}
+	}
+
+	for _, cookie := range response.Cookies {
+		ctx.Writer.Header().Add("Set-Cookie", cookie)
+	}
+
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, gin.H{"message": "Internal Server Error"})
+			return
+		}
+		body = decoded
+	}
+
+	status := response.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	ctx.Status(status)
+	ctx.Writer.Write(body)
+}
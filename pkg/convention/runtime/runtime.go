@@ -37,6 +37,19 @@ func FromServices(c config.Config, r RuntimeService) Convention {
 }
 
 func (c Convention) Emulate(ctx context.Context, i release.Image) error {
+	return c.EmulateOnPort(ctx, i, 9000)
+}
+
+// EmulateOnPort runs the image behind the runtime interface emulator, listening on the given host port.
+func (c Convention) EmulateOnPort(ctx context.Context, i release.Image, port int) error {
+	if i.Archive != "" {
+		return fmt.Errorf("cannot emulate an image built to an archive, use the docker, buildx or podman builder")
+	}
+
+	if i.Zip != "" {
+		return fmt.Errorf("cannot emulate a zip package, add a Dockerfile to run it locally")
+	}
+
 	command := append(i.Config.Entrypoint, i.Config.Cmd...)
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -67,6 +80,7 @@ func (c Convention) Emulate(ctx context.Context, i release.Image) error {
 		AccessKeyId:     *creds.AccessKeyId,
 		SecretAccessKey: *creds.SecretAccessKey,
 		SessionToken:    *creds.SessionToken,
+		Port:            port,
 	}
 
 	if err := c.Service.Runtime.Deploy(ctx, deployInput); err != nil {
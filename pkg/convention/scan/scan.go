@@ -0,0 +1,281 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/linecard/self/pkg/convention/config"
+	"github.com/linecard/self/pkg/convention/manifest"
+	"github.com/linecard/self/pkg/convention/release"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/rs/zerolog/log"
+)
+
+type RegistryService interface {
+	ScanFindings(ctx context.Context, registryId, repository, digest string) (*ecr.DescribeImageScanFindingsOutput, error)
+}
+
+type EventService interface {
+	Emit(ctx context.Context, accountId, busName, detailType string, detail any) error
+}
+
+type Services struct {
+	Registry RegistryService
+	Event    EventService
+}
+
+type Convention struct {
+	Config  config.Config
+	Service Services
+}
+
+func FromServices(c config.Config, r RegistryService, e EventService) Convention {
+	return Convention{
+		Config: c,
+		Service: Services{
+			Registry: r,
+			Event:    e,
+		},
+	}
+}
+
+// Policy blocks findings at or above Severity, unless their vulnerability id is allowed.
+type Policy struct {
+	Severity string
+	Allow    map[string]bool
+}
+
+type Finding struct {
+	Id       string
+	Severity string
+	Package  string
+}
+
+type Verdict struct {
+	Blocking []Finding
+	Allowed  []Finding
+}
+
+func (v Verdict) Passed() bool {
+	return len(v.Blocking) == 0
+}
+
+var severities = map[string]int{
+	"INFORMATIONAL": 1,
+	"LOW":           2,
+	"MEDIUM":        3,
+	"HIGH":          4,
+	"CRITICAL":      5,
+}
+
+// Gate waits for the release's scan and returns an error when the findings fail the policy,
+// after emitting a "Blocked" event on the bus if one is configured. Zip packages and releases
+// outside ECR are not scanned and always pass.
+func (c Convention) Gate(ctx context.Context, r release.Release) error {
+	ctx, span := otel.Tracer("").Start(ctx, "scan.gate")
+	defer span.End()
+
+	if c.Config.Scan.Severity == "" {
+		return nil
+	}
+
+	if _, _, zip := r.ZipPackage(); zip || c.Config.Registry.Oci() {
+		log.Info().Msgf("skipping scan gate, %s is not in ECR", r.Uri)
+		return nil
+	}
+
+	repository, digest, err := parseUri(r.Uri)
+	if err != nil {
+		return err
+	}
+
+	deploytime, err := c.Config.DeployTime(r.Config.Labels)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(
+		attribute.String("repository-name", repository),
+		attribute.String("image-digest", digest),
+		attribute.String("severity", c.Config.Scan.Severity),
+	)
+
+	findings, err := c.Service.Registry.ScanFindings(ctx, c.Config.Registry.Id, repository, digest)
+	if err != nil {
+		return err
+	}
+
+	policy := Policy{
+		Severity: c.Config.Scan.Severity,
+		Allow:    c.allowlist(deploytime),
+	}
+
+	verdict := Evaluate(policy, findings)
+	for _, finding := range verdict.Allowed {
+		log.Info().Msgf("allowing %s %s in %s", finding.Severity, finding.Id, finding.Package)
+	}
+
+	if verdict.Passed() {
+		return nil
+	}
+
+	var ids []string
+	for _, finding := range verdict.Blocking {
+		ids = append(ids, finding.Id)
+		log.Error().Msgf("%s %s in %s", finding.Severity, finding.Id, finding.Package)
+	}
+
+	reason := fmt.Sprintf("%d findings at or above %s", len(verdict.Blocking), policy.Severity)
+	span.SetAttributes(attribute.StringSlice("findings", ids))
+
+	if c.Config.Bus.Name != nil {
+		detail := config.EventDetail{
+			Action:         "Blocked",
+			Sha:            deploytime.Sha.Decoded,
+			Branch:         deploytime.Branch.Decoded,
+			Origin:         deploytime.Origin.Decoded,
+			RepositoryName: repository,
+			ResourceName:   deploytime.Computed.Resource.Name,
+			Reason:         reason,
+			Findings:       ids,
+		}
+
+		if err := c.Service.Event.Emit(ctx, c.Config.Registry.Id, *c.Config.Bus.Name, detail.Action, detail); err != nil {
+			log.Warn().Err(err).Msg("failed to emit blocked event")
+		}
+	}
+
+	return fmt.Errorf("release %s blocked by %s: %s", deploytime.Sha.Decoded, reason, strings.Join(ids, ", "))
+}
+
+// allowlist is the deployer's allowlist. The release's own is added only when trusted keys are configured,
+// as deploying then verifies a trusted signature over its labels, so no publisher can allow their own findings.
+func (c Convention) allowlist(deploytime config.DeployTime) map[string]bool {
+	allow := make(map[string]bool)
+	for _, id := range c.Config.Scan.Allowlist {
+		allow[id] = true
+	}
+
+	released := ParseAllowlist(deploytime.Allowlist.Decoded)
+	if len(released) == 0 {
+		return allow
+	}
+
+	if len(c.Config.Signing.Trusted) == 0 {
+		log.Warn().Msgf("ignoring the release's %s, set %s to honour allowlists of signed releases", manifest.AllowlistFile, config.EnvTrustedKeys)
+		return allow
+	}
+
+	for id := range released {
+		allow[id] = true
+	}
+
+	return allow
+}
+
+// Evaluate checks scan findings against the policy. Basic and enhanced findings are both considered,
+// enhanced findings only while active. Findings of unknown severity never block.
+func Evaluate(policy Policy, output *ecr.DescribeImageScanFindingsOutput) Verdict {
+	var verdict Verdict
+
+	if output == nil || output.ImageScanFindings == nil {
+		return verdict
+	}
+
+	threshold := severities[strings.ToUpper(policy.Severity)]
+	if threshold == 0 {
+		return verdict
+	}
+
+	var findings []Finding
+
+	for _, finding := range output.ImageScanFindings.Findings {
+		findings = append(findings, Finding{
+			Id:       aws.ToString(finding.Name),
+			Severity: string(finding.Severity),
+			Package:  attributeValue(finding.Attributes, "package_name"),
+		})
+	}
+
+	for _, finding := range output.ImageScanFindings.EnhancedFindings {
+		if finding.Status != nil && *finding.Status != "ACTIVE" {
+			continue
+		}
+
+		id := aws.ToString(finding.Title)
+		var pkg string
+		if details := finding.PackageVulnerabilityDetails; details != nil {
+			id = aws.ToString(details.VulnerabilityId)
+			if len(details.VulnerablePackages) > 0 {
+				pkg = aws.ToString(details.VulnerablePackages[0].Name)
+			}
+		}
+
+		findings = append(findings, Finding{
+			Id:       id,
+			Severity: aws.ToString(finding.Severity),
+			Package:  pkg,
+		})
+	}
+
+	for _, finding := range findings {
+		if severities[strings.ToUpper(finding.Severity)] < threshold {
+			continue
+		}
+
+		if policy.Allow[finding.Id] {
+			verdict.Allowed = append(verdict.Allowed, finding)
+			continue
+		}
+
+		verdict.Blocking = append(verdict.Blocking, finding)
+	}
+
+	sort.Slice(verdict.Blocking, func(i, j int) bool {
+		return verdict.Blocking[i].Id < verdict.Blocking[j].Id
+	})
+
+	return verdict
+}
+
+// ParseAllowlist reads one vulnerability id per line, ignoring blank lines and # comments.
+func ParseAllowlist(content string) map[string]bool {
+	allow := make(map[string]bool)
+
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			allow[line] = true
+		}
+	}
+
+	return allow
+}
+
+// parseUri splits "<registry>/<repository>@sha256:<hex>" into repository and digest.
+func parseUri(uri string) (string, string, error) {
+	_, path, _ := strings.Cut(uri, "/")
+	repository, digest, found := strings.Cut(path, "@")
+	if !found {
+		return "", "", fmt.Errorf("release uri %s has no digest", uri)
+	}
+
+	return repository, digest, nil
+}
+
+func attributeValue(attributes []ecrTypes.Attribute, key string) string {
+	for _, attribute := range attributes {
+		if aws.ToString(attribute.Key) == key {
+			return aws.ToString(attribute.Value)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,202 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/linecard/self/pkg/convention/config"
+)
+
+func basicFinding(id string, severity ecrTypes.FindingSeverity, pkg string) ecrTypes.ImageScanFinding {
+	return ecrTypes.ImageScanFinding{
+		Name:       aws.String(id),
+		Severity:   severity,
+		Attributes: []ecrTypes.Attribute{{Key: aws.String("package_name"), Value: aws.String(pkg)}},
+	}
+}
+
+func enhancedFinding(id, severity, status, pkg string) ecrTypes.EnhancedImageScanFinding {
+	return ecrTypes.EnhancedImageScanFinding{
+		Title:    aws.String(id + " in " + pkg),
+		Severity: aws.String(severity),
+		Status:   aws.String(status),
+		PackageVulnerabilityDetails: &ecrTypes.PackageVulnerabilityDetails{
+			VulnerabilityId:    aws.String(id),
+			VulnerablePackages: []ecrTypes.VulnerablePackage{{Name: aws.String(pkg)}},
+		},
+	}
+}
+
+func findings(basic []ecrTypes.ImageScanFinding, enhanced []ecrTypes.EnhancedImageScanFinding) *ecr.DescribeImageScanFindingsOutput {
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageScanFindings: &ecrTypes.ImageScanFindings{
+			Findings:         basic,
+			EnhancedFindings: enhanced,
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   Policy
+		output   *ecr.DescribeImageScanFindingsOutput
+		blocking []Finding
+		allowed  []Finding
+	}{
+		{
+			name:   "basic findings below the threshold pass",
+			policy: Policy{Severity: "HIGH"},
+			output: findings([]ecrTypes.ImageScanFinding{
+				basicFinding("CVE-2024-0001", ecrTypes.FindingSeverityMedium, "zlib"),
+				basicFinding("CVE-2024-0002", ecrTypes.FindingSeverityLow, "curl"),
+			}, nil),
+		},
+		{
+			name:   "basic findings at or above the threshold block, sorted by id",
+			policy: Policy{Severity: "high"},
+			output: findings([]ecrTypes.ImageScanFinding{
+				basicFinding("CVE-2024-0003", ecrTypes.FindingSeverityCritical, "openssl"),
+				basicFinding("CVE-2024-0001", ecrTypes.FindingSeverityHigh, "zlib"),
+				basicFinding("CVE-2024-0002", ecrTypes.FindingSeverityMedium, "curl"),
+			}, nil),
+			blocking: []Finding{
+				{Id: "CVE-2024-0001", Severity: "HIGH", Package: "zlib"},
+				{Id: "CVE-2024-0003", Severity: "CRITICAL", Package: "openssl"},
+			},
+		},
+		{
+			name:   "allowlisted findings are allowed",
+			policy: Policy{Severity: "HIGH", Allow: map[string]bool{"CVE-2024-0003": true}},
+			output: findings([]ecrTypes.ImageScanFinding{
+				basicFinding("CVE-2024-0003", ecrTypes.FindingSeverityCritical, "openssl"),
+			}, []ecrTypes.EnhancedImageScanFinding{
+				enhancedFinding("CVE-2024-0004", "HIGH", "ACTIVE", "glibc"),
+			}),
+			blocking: []Finding{{Id: "CVE-2024-0004", Severity: "HIGH", Package: "glibc"}},
+			allowed:  []Finding{{Id: "CVE-2024-0003", Severity: "CRITICAL", Package: "openssl"}},
+		},
+		{
+			name:   "inactive enhanced findings are skipped",
+			policy: Policy{Severity: "HIGH"},
+			output: findings(nil, []ecrTypes.EnhancedImageScanFinding{
+				enhancedFinding("CVE-2024-0005", "CRITICAL", "CLOSED", "openssl"),
+				enhancedFinding("CVE-2024-0006", "CRITICAL", "SUPPRESSED", "openssl"),
+				enhancedFinding("CVE-2024-0007", "CRITICAL", "ACTIVE", "openssl"),
+			}),
+			blocking: []Finding{{Id: "CVE-2024-0007", Severity: "CRITICAL", Package: "openssl"}},
+		},
+		{
+			name:   "findings of unknown severity never block",
+			policy: Policy{Severity: "INFORMATIONAL"},
+			output: findings([]ecrTypes.ImageScanFinding{
+				basicFinding("CVE-2024-0008", ecrTypes.FindingSeverityUndefined, "zlib"),
+			}, []ecrTypes.EnhancedImageScanFinding{
+				enhancedFinding("CVE-2024-0009", "UNTRIAGED", "ACTIVE", "curl"),
+			}),
+		},
+		{
+			name:   "an unknown threshold blocks nothing",
+			policy: Policy{Severity: "SEVERE"},
+			output: findings([]ecrTypes.ImageScanFinding{
+				basicFinding("CVE-2024-0010", ecrTypes.FindingSeverityCritical, "openssl"),
+			}, nil),
+		},
+		{
+			name:   "no findings pass",
+			policy: Policy{Severity: "LOW"},
+			output: &ecr.DescribeImageScanFindingsOutput{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			verdict := Evaluate(tc.policy, tc.output)
+
+			if !reflect.DeepEqual(verdict.Blocking, tc.blocking) {
+				t.Errorf("blocking = %v, want %v", verdict.Blocking, tc.blocking)
+			}
+
+			if !reflect.DeepEqual(verdict.Allowed, tc.allowed) {
+				t.Errorf("allowed = %v, want %v", verdict.Allowed, tc.allowed)
+			}
+
+			if verdict.Passed() != (len(tc.blocking) == 0) {
+				t.Errorf("passed = %v with %d blocking", verdict.Passed(), len(tc.blocking))
+			}
+		})
+	}
+}
+
+func TestParseAllowlist(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		allow   map[string]bool
+	}{
+		{
+			name:    "empty",
+			content: "",
+			allow:   map[string]bool{},
+		},
+		{
+			name:    "one id per line",
+			content: "CVE-2024-0001\nCVE-2024-0002\n",
+			allow:   map[string]bool{"CVE-2024-0001": true, "CVE-2024-0002": true},
+		},
+		{
+			name:    "comments and blank lines are ignored",
+			content: "# openssl, no fix upstream yet\n\n  CVE-2024-0003  # until the next base image\n\t\n# CVE-2024-0004\n",
+			allow:   map[string]bool{"CVE-2024-0003": true},
+		},
+		{
+			name:    "windows line endings",
+			content: "CVE-2024-0005\r\nGHSA-xxxx-yyyy-zzzz\r\n",
+			allow:   map[string]bool{"CVE-2024-0005": true, "GHSA-xxxx-yyyy-zzzz": true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if allow := ParseAllowlist(tc.content); !reflect.DeepEqual(allow, tc.allow) {
+				t.Errorf("allow = %v, want %v", allow, tc.allow)
+			}
+		})
+	}
+}
+
+func TestAllowlistHonoursReleasesOnlyWithTrustedKeys(t *testing.T) {
+	var deploytime config.DeployTime
+	deploytime.Allowlist.Decoded = "CVE-2024-0001\n"
+
+	cases := []struct {
+		name    string
+		trusted []string
+		allow   map[string]bool
+	}{
+		{
+			name:  "without trusted keys only the deployer's allowlist applies",
+			allow: map[string]bool{"CVE-2024-0002": true},
+		},
+		{
+			name:    "with trusted keys releases add their own",
+			trusted: []string{"alias/release-signing"},
+			allow:   map[string]bool{"CVE-2024-0001": true, "CVE-2024-0002": true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Convention
+			c.Config.Scan.Allowlist = []string{"CVE-2024-0002"}
+			c.Config.Signing.Trusted = tc.trusted
+
+			if allow := c.allowlist(deploytime); !reflect.DeepEqual(allow, tc.allow) {
+				t.Errorf("allow = %v, want %v", allow, tc.allow)
+			}
+		})
+	}
+}
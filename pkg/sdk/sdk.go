@@ -9,26 +9,38 @@ import (
 	// clients
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	// services
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/linecard/self/pkg/service/bundle"
 	"github.com/linecard/self/pkg/service/docker"
 	"github.com/linecard/self/pkg/service/event"
 	"github.com/linecard/self/pkg/service/function"
 	"github.com/linecard/self/pkg/service/gateway"
+	"github.com/linecard/self/pkg/service/ledger"
 	"github.com/linecard/self/pkg/service/registry"
+	"github.com/linecard/self/pkg/service/signing"
 
 	// conventions
 	"github.com/linecard/self/pkg/convention/account"
 	"github.com/linecard/self/pkg/convention/bus"
 	"github.com/linecard/self/pkg/convention/deployment"
+	"github.com/linecard/self/pkg/convention/history"
 	"github.com/linecard/self/pkg/convention/httproxy"
+	"github.com/linecard/self/pkg/convention/openapi"
+	"github.com/linecard/self/pkg/convention/permission"
 	"github.com/linecard/self/pkg/convention/release"
 	"github.com/linecard/self/pkg/convention/runtime"
+	"github.com/linecard/self/pkg/convention/scan"
 )
 
 type Clients struct {
@@ -39,14 +51,39 @@ type Clients struct {
 	IamClient          *iam.Client
 	EventBridgeClient  *eventbridge.Client
 	ApiGatewayV2Client *apigatewayv2.Client
+	DynamoDBClient     *dynamodb.Client
+	S3Client           *s3.Client
+	KmsClient          *kms.Client
+	TaggingClient      *resourcegroupstaggingapi.Client
+}
+
+// RegistryService is satisfied by both the ECR and the OCI distribution registry services.
+type RegistryService interface {
+	InspectByTag(ctx context.Context, registryId, repository, tag string) (dockerTypes.ImageInspect, error)
+	InspectByDigest(ctx context.Context, registryId, repository, digest string) (dockerTypes.ImageInspect, error)
+	ImageUri(ctx context.Context, registryId, registryUrl, repository, tag string) (string, error)
+	Digest(ctx context.Context, registryId, repository, tag string) (string, error)
+	List(ctx context.Context, registryUrl, repositoryName string) (ecr.DescribeImagesOutput, error)
+	Delete(ctx context.Context, registryId, repository string, imageDigests []string) error
+	Untag(ctx context.Context, registryId, repository, tag string) error
+	PutRepository(ctx context.Context, repositoryName string) error
+	Token(ctx context.Context, registryId string) (string, error)
+	PushArchive(ctx context.Context, registryId, registryUrl, repository, path string, labels map[string]string, tags []string) (string, error)
+	ScanFindings(ctx context.Context, registryId, repository, digest string) (*ecr.DescribeImageScanFindingsOutput, error)
+	PutSignature(ctx context.Context, registryId, registryUrl, repository, digest string, signature []byte) error
+	Signature(ctx context.Context, registryId, repository, digest string) ([]byte, error)
+	DeleteSignature(ctx context.Context, registryId, repository, digest string) error
 }
 
 type Services struct {
 	Docker   docker.Service
-	Registry registry.Service
+	Registry RegistryService
+	Package  bundle.Service
 	Function function.Service
 	Event    event.Service
 	Gateway  gateway.Service
+	Ledger   history.LedgerService
+	Signing  signing.Service
 }
 
 type Conventions struct {
@@ -57,6 +94,10 @@ type Conventions struct {
 	Subscription bus.Convention
 	Httproxy     httproxy.Convention
 	Bus          bus.Convention
+	History      history.Convention
+	OpenApi      openapi.Convention
+	Permission   permission.Convention
+	Scan         scan.Convention
 }
 
 type API struct {
@@ -70,7 +111,7 @@ func Init(ctx context.Context, awsConfig aws.Config, config config.Config) (API,
 		return API{}, err
 	}
 
-	services, err := InitServices(ctx, clients)
+	services, err := InitServices(ctx, config, clients)
 	if err != nil {
 		return API{}, err
 	}
@@ -90,27 +131,62 @@ func InitConventions(ctx context.Context, config config.Config, services Service
 	return Conventions{
 		Account:      account.FromServices(config, services.Docker, services.Registry),
 		Runtime:      runtime.FromServices(config, services.Docker),
-		Release:      release.FromServices(config, services.Registry, services.Docker),
-		Deployment:   deployment.FromServices(config, services.Function, services.Registry),
-		Subscription: bus.FromServices(config, services.Registry, services.Event),
-		Httproxy:     httproxy.FromServices(config, services.Gateway, services.Registry),
-		Bus:          bus.FromServices(config, services.Registry, services.Event),
+		Release:      release.FromServices(config, services.Registry, services.Package, services.Docker, services.Signing),
+		Deployment:   deployment.FromServices(config, services.Function, services.Registry, services.Package, services.Signing),
+		Subscription: bus.FromServices(config, services.Registry, services.Package, services.Event),
+		Httproxy:     httproxy.FromServices(config, services.Gateway, services.Registry, services.Package),
+		Bus:          bus.FromServices(config, services.Registry, services.Package, services.Event),
+		History:      history.FromServices(config, services.Ledger),
+		OpenApi:      openapi.FromServices(config),
+		Permission:   permission.FromServices(config, services.Function, services.Gateway, services.Event),
+		Scan:         scan.FromServices(config, services.Registry, services.Event),
 	}, nil
 }
 
-func InitServices(ctx context.Context, clients Clients) (Services, error) {
+func InitServices(ctx context.Context, config config.Config, clients Clients) (Services, error) {
 	docker, err := docker.FromPath(ctx)
 	if err != nil {
 		return Services{}, err
 	}
+	docker = docker.WithBuilder(config.Builder.Backend, config.Builder.Host)
+
+	cache := registry.NewCache("")
+	if config.Cache.Dir != nil {
+		cache = registry.NewCache(*config.Cache.Dir)
+	}
 
-	return Services{
+	settings := registry.Settings{
+		PullAccounts:       config.Repositories.PullAccounts,
+		ExpireUntaggedDays: config.Repositories.ExpireUntaggedDays,
+	}
+
+	services := Services{
 		Docker:   docker,
-		Registry: registry.FromClients(clients.EcrClient),
-		Function: function.FromClients(clients.LambdaClient, clients.IamClient),
+		Registry: registry.FromClients(clients.EcrClient, cache).WithSettings(settings).WithArchitecture(config.Registry.Architecture),
+		Package:  bundle.FromClients(clients.S3Client, config.Packages.Bucket),
+		Function: function.FromClients(clients.LambdaClient, clients.IamClient, clients.TaggingClient),
 		Event:    event.FromClients(clients.EventBridgeClient, clients.LambdaClient),
-		Gateway:  gateway.FromClients(clients.ApiGatewayV2Client, clients.LambdaClient),
-	}, nil
+		Gateway:  gateway.FromClients(clients.ApiGatewayV2Client),
+		Signing:  signing.FromClients(clients.KmsClient),
+	}
+
+	if config.Registry.Oci() {
+		services.Registry = registry.FromUrl(config.Registry.Endpoint, cache).WithCredentials(registry.Credentials{
+			Username: config.Registry.Username,
+			Password: config.Registry.Password,
+		}).WithArchitecture(config.Registry.Architecture)
+	}
+
+	switch {
+	case config.History.Path != nil:
+		services.Ledger = ledger.FromPath(*config.History.Path)
+	case config.History.Table != nil:
+		services.Ledger = ledger.FromClients(clients.DynamoDBClient, *config.History.Table)
+	case config.History.Bucket != nil:
+		services.Ledger = ledger.FromBucket(clients.S3Client, *config.History.Bucket)
+	}
+
+	return services, nil
 }
 
 func InitClients(ctx context.Context, awsConfig aws.Config) (Clients, error) {
@@ -122,5 +198,9 @@ func InitClients(ctx context.Context, awsConfig aws.Config) (Clients, error) {
 		IamClient:          iam.NewFromConfig(awsConfig),
 		EventBridgeClient:  eventbridge.NewFromConfig(awsConfig),
 		ApiGatewayV2Client: apigatewayv2.NewFromConfig(awsConfig),
+		DynamoDBClient:     dynamodb.NewFromConfig(awsConfig),
+		S3Client:           s3.NewFromConfig(awsConfig),
+		KmsClient:          kms.NewFromConfig(awsConfig),
+		TaggingClient:      resourcegroupstaggingapi.NewFromConfig(awsConfig),
 	}, nil
 }
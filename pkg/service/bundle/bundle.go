@@ -0,0 +1,378 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/rs/zerolog/log"
+)
+
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+type Clients struct {
+	S3 S3Client
+}
+
+// Service publishes zip packages to a bucket laid out like a registry, per repository:
+//
+//	<repository>/sha256-<hex>.zip    the package, addressed by its digest
+//	<repository>/sha256-<hex>.json   its sidecar, standing in for an image config
+//	<repository>/sha256-<hex>.sig    its signature, when releases are signed
+//	<repository>/tags/<tag>          the digest a tag points at
+//
+// Its methods mirror the registry's, so releases are found, listed and collected the same way.
+type Service struct {
+	Client Clients
+	Bucket string
+}
+
+// Sidecar carries the release labels and what Lambda needs to run the package.
+type Sidecar struct {
+	Architecture string            `json:"architecture"`
+	Runtime      string            `json:"runtime"`
+	Handler      string            `json:"handler"`
+	Created      string            `json:"created"`
+	Labels       map[string]string `json:"labels"`
+}
+
+func FromClients(s3Client S3Client, bucket string) Service {
+	return Service{
+		Client: Clients{
+			S3: s3Client,
+		},
+		Bucket: bucket,
+	}
+}
+
+// Exists reports whether the repository has any tagged package, always false without a bucket.
+func (s Service) Exists(ctx context.Context, repository string) (bool, error) {
+	if s.Bucket == "" {
+		return false, nil
+	}
+
+	list, err := s.Client.S3.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.Bucket),
+		Prefix:  aws.String(repository + "/tags/"),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return aws.ToInt32(list.KeyCount) > 0, nil
+}
+
+func (s Service) InspectByTag(ctx context.Context, registryId, repository, tag string) (dockerTypes.ImageInspect, error) {
+	digest, err := s.digest(ctx, repository, tag)
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	return s.InspectByDigest(ctx, registryId, repository, digest)
+}
+
+// InspectByDigest reads a package's sidecar as an image config. Like a Lambda base image,
+// the runtime is its entrypoint and the handler its command.
+func (s Service) InspectByDigest(ctx context.Context, registryId, repository, digest string) (dockerTypes.ImageInspect, error) {
+	var sidecar Sidecar
+
+	content, err := s.get(ctx, s.key(repository, digest, ".json"))
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	if err := json.Unmarshal(content, &sidecar); err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	return dockerTypes.ImageInspect{
+		ID:           "sha256:" + digest,
+		Architecture: sidecar.Architecture,
+		Os:           "linux",
+		Created:      sidecar.Created,
+		Config: &container.Config{
+			Labels:     sidecar.Labels,
+			Entrypoint: []string{sidecar.Runtime},
+			Cmd:        []string{sidecar.Handler},
+		},
+	}, nil
+}
+
+// ImageUri returns the s3:// uri of the package a tag points at.
+func (s Service) ImageUri(ctx context.Context, registryId, registryUrl, repository, tag string) (string, error) {
+	digest, err := s.digest(ctx, repository, tag)
+	if err != nil {
+		return "", err
+	}
+
+	return "s3://" + s.Bucket + "/" + s.key(repository, digest, ".zip"), nil
+}
+
+// Digest returns the digest of the package a tag points at.
+func (s Service) Digest(ctx context.Context, registryId, repository, tag string) (string, error) {
+	digest, err := s.digest(ctx, repository, tag)
+	if err != nil {
+		return "", err
+	}
+
+	return "sha256:" + digest, nil
+}
+
+// ParseUri splits an s3:// package uri into bucket, repository and hex digest.
+func ParseUri(uri string) (bucket, repository, digest string, err error) {
+	path, found := strings.CutPrefix(uri, "s3://")
+	if !found {
+		return "", "", "", fmt.Errorf("%s is not an s3 uri", uri)
+	}
+
+	bucket, key, _ := strings.Cut(path, "/")
+	slash := strings.LastIndex(key, "/")
+	if slash < 0 || !strings.HasPrefix(key[slash+1:], "sha256-") {
+		return "", "", "", fmt.Errorf("%s is not a package uri", uri)
+	}
+
+	repository = key[:slash]
+	digest = strings.TrimSuffix(strings.TrimPrefix(key[slash+1:], "sha256-"), ".zip")
+	return bucket, repository, digest, nil
+}
+
+// List describes tagged packages as ECR would describe images, the tag's last write standing in for push time.
+func (s Service) List(ctx context.Context, registryUrl, repository string) (ecr.DescribeImagesOutput, error) {
+	var output ecr.DescribeImagesOutput
+
+	details := make(map[string]*ecrTypes.ImageDetail)
+	var digests []string
+
+	paginator := s3.NewListObjectsV2Paginator(s.Client.S3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(repository + "/tags/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return ecr.DescribeImagesOutput{}, s.apiError(err)
+		}
+
+		for _, object := range page.Contents {
+			tag := strings.TrimPrefix(aws.ToString(object.Key), repository+"/tags/")
+
+			digest, err := s.digest(ctx, repository, tag)
+			if err != nil {
+				return ecr.DescribeImagesOutput{}, err
+			}
+
+			if detail, ok := details[digest]; ok {
+				detail.ImageTags = append(detail.ImageTags, tag)
+				if object.LastModified != nil && object.LastModified.After(*detail.ImagePushedAt) {
+					detail.ImagePushedAt = object.LastModified
+				}
+				continue
+			}
+
+			details[digest] = &ecrTypes.ImageDetail{
+				ImageDigest:    aws.String("sha256:" + digest),
+				ImageTags:      []string{tag},
+				ImagePushedAt:  aws.Time(aws.ToTime(object.LastModified)),
+				RepositoryName: aws.String(repository),
+			}
+			digests = append(digests, digest)
+		}
+	}
+
+	for _, digest := range digests {
+		output.ImageDetails = append(output.ImageDetails, *details[digest])
+	}
+
+	return output, nil
+}
+
+// Delete removes packages with their sidecars and signatures, digests may carry the "sha256:" prefix.
+func (s Service) Delete(ctx context.Context, registryId, repository string, digests []string) error {
+	for _, digest := range digests {
+		digest = strings.TrimPrefix(digest, "sha256:")
+		for _, suffix := range []string{".zip", ".json", ".sig"} {
+			if err := s.delete(ctx, s.key(repository, digest, suffix)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s Service) Untag(ctx context.Context, registryId, repository, tag string) error {
+	return s.delete(ctx, repository+"/tags/"+tag)
+}
+
+func (s Service) PutSignature(ctx context.Context, registryId, registryUrl, repository, digest string, signature []byte) error {
+	return s.put(ctx, s.key(repository, strings.TrimPrefix(digest, "sha256:"), ".sig"), signature, "application/json")
+}
+
+// Signature reads the signature of a package, ImageNotFoundException when it has none.
+func (s Service) Signature(ctx context.Context, registryId, repository, digest string) ([]byte, error) {
+	return s.get(ctx, s.key(repository, strings.TrimPrefix(digest, "sha256:"), ".sig"))
+}
+
+func (s Service) DeleteSignature(ctx context.Context, registryId, repository, digest string) error {
+	return s.delete(ctx, s.key(repository, strings.TrimPrefix(digest, "sha256:"), ".sig"))
+}
+
+// PutRepository is a no-op, repositories are key prefixes.
+func (s Service) PutRepository(ctx context.Context, repository string) error {
+	return nil
+}
+
+// Push uploads the zip at path with its sidecar, then points each tag at it. Returns the package's digest.
+func (s Service) Push(ctx context.Context, repository, path string, sidecar Sidecar, tags []string) (string, error) {
+	if s.Bucket == "" {
+		return "", fmt.Errorf("zip packages are published to a bucket, set SELF_PACKAGE_BUCKET")
+	}
+
+	digest, size, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = s.Client.S3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(s.key(repository, digest, ".zip")),
+		Body:          file,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String("application/zip"),
+	})
+	if err != nil {
+		return "", s.apiError(err)
+	}
+
+	if sidecar.Created == "" {
+		sidecar.Created = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	content, err := json.Marshal(sidecar)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.put(ctx, s.key(repository, digest, ".json"), content, "application/json"); err != nil {
+		return "", err
+	}
+
+	for _, tag := range tags {
+		if err := s.put(ctx, repository+"/tags/"+tag, []byte(digest), "text/plain"); err != nil {
+			return "", fmt.Errorf("tag %s: %w", tag, err)
+		}
+		log.Info().Msgf("pushed s3://%s/%s:%s", s.Bucket, repository, tag)
+	}
+
+	return "sha256:" + digest, nil
+}
+
+func (s Service) key(repository, digest, suffix string) string {
+	return repository + "/sha256-" + digest + suffix
+}
+
+func (s Service) digest(ctx context.Context, repository, tag string) (string, error) {
+	content, err := s.get(ctx, repository+"/tags/"+tag)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (s Service) get(ctx context.Context, key string) ([]byte, error) {
+	if s.Bucket == "" {
+		return nil, &smithy.GenericAPIError{Code: "RepositoryNotFoundException", Message: "no package bucket configured"}
+	}
+
+	object, err := s.Client.S3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s.apiError(err)
+	}
+	defer object.Body.Close()
+
+	return io.ReadAll(object.Body)
+}
+
+func (s Service) put(ctx context.Context, key string, content []byte, contentType string) error {
+	_, err := s.Client.S3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(contentType),
+	})
+	return s.apiError(err)
+}
+
+func (s Service) delete(ctx context.Context, key string) error {
+	_, err := s.Client.S3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	return s.apiError(err)
+}
+
+// apiError maps missing keys onto the ECR error codes the conventions already handle.
+func (s Service) apiError(err error) error {
+	var noSuchKey *s3Types.NoSuchKey
+	var noSuchBucket *s3Types.NoSuchBucket
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &noSuchKey):
+		return &smithy.GenericAPIError{Code: "ImageNotFoundException", Message: err.Error()}
+	case errors.As(err, &noSuchBucket):
+		return &smithy.GenericAPIError{Code: "RepositoryNotFoundException", Message: err.Error()}
+	default:
+		return err
+	}
+}
+
+func fileDigest(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
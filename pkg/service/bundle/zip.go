@@ -0,0 +1,199 @@
+package bundle
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// excluded are self's own files, they travel as labels rather than in the package.
+var excluded = map[string]bool{
+	"policy.json.tmpl":    true,
+	"resources.json.tmpl": true,
+	"openapi.yaml":        true,
+	"bus":                 true,
+	".git":                true,
+}
+
+type ZipInput struct {
+	FunctionPath string
+	Runtime      string
+	Output       string
+}
+
+// Zip packages the function directory, installing requirements.txt or package.json dependencies
+// for the runtime first. Entries are sorted and timestamps fixed, so unchanged sources zip to the same digest.
+func (s Service) Zip(ctx context.Context, i ZipInput) error {
+	staging, err := os.MkdirTemp("", "self-zip-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := stage(i.FunctionPath, staging); err != nil {
+		return err
+	}
+
+	if err := install(ctx, staging, i.Runtime); err != nil {
+		return err
+	}
+
+	return archive(staging, i.Output)
+}
+
+func stage(source, staging string) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(source, path)
+		if err != nil || relative == "." {
+			return err
+		}
+
+		if filepath.Dir(relative) == "." && excluded[relative] {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		target := filepath.Join(staging, relative)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			log.Debug().Msgf("skipping %s, not a regular file", path)
+			return nil
+		}
+	})
+}
+
+func install(ctx context.Context, staging, runtime string) error {
+	var name string
+	var args []string
+
+	switch {
+	case strings.HasPrefix(runtime, "python") && exists(staging, "requirements.txt"):
+		name = "pip3"
+		args = []string{"install", "--quiet", "-r", "requirements.txt", "-t", "."}
+	case strings.HasPrefix(runtime, "nodejs") && exists(staging, "package.json") && !exists(staging, "node_modules"):
+		name = "npm"
+		args = []string{"install", "--omit=dev", "--no-audit", "--no-fund"}
+	default:
+		return nil
+	}
+
+	binary, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("%s is needed to install the function's dependencies: %w", name, err)
+	}
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Dir = staging
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+func archive(staging, output string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	epoch := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// WalkDir visits entries in lexical order, which keeps the archive reproducible.
+	err = filepath.WalkDir(staging, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		relative, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relative)
+		header.Method = zip.Deflate
+		header.Modified = epoch
+
+		target, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+
+		_, err = io.Copy(target, source)
+		return err
+	})
+
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+func copyFile(source, target string, mode fs.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func exists(dir, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
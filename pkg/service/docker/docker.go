@@ -14,8 +14,33 @@ import (
 )
 
 type Service struct {
-	Root   string
-	Binary string
+	Root    string
+	Binary  string
+	Builder Builder
+}
+
+// Builder is the backend building images: docker, buildx, podman or buildkit.
+type Builder struct {
+	Backend string
+	Binary  string
+	Host    string
+}
+
+type BuildInput struct {
+	FunctionPath string
+	ContextPath  string
+	Labels       map[string]string
+	Tags         []string
+	Platform     string
+	BuildArgs    map[string]string
+	// Secrets are BuildKit secret specs, e.g. "id=npm,env=NPM_TOKEN" or "id=netrc,src=/home/me/.netrc".
+	Secrets []string
+	Ssh     bool
+	// Cache is the registry ref layers are cached under between builds, e.g. "<repository url>:buildcache".
+	Cache string
+	// Output receives an OCI archive rather than loading the image locally, written by buildkit and by
+	// multi-platform buildx builds.
+	Output string
 }
 
 type DeployInput struct {
@@ -27,6 +52,7 @@ type DeployInput struct {
 	AccessKeyId     string
 	SecretAccessKey string
 	SessionToken    string
+	Port            int
 }
 
 func FromPath(ctx context.Context) (Service, error) {
@@ -36,11 +62,41 @@ func FromPath(ctx context.Context) (Service, error) {
 		return Service{}, nil
 	}
 
-	return Service{Binary: binary}, nil
+	return Service{Binary: binary, Builder: Builder{Backend: "docker", Binary: binary}}, nil
+}
+
+// WithBuilder switches the build backend. A missing binary is only reported once a build is attempted.
+func (s Service) WithBuilder(backend, host string) Service {
+	names := map[string]string{
+		"docker":   "docker",
+		"buildx":   "docker",
+		"podman":   "podman",
+		"buildkit": "buildctl",
+	}
+
+	if backend == "" {
+		backend = "docker"
+	}
+
+	binary, err := exec.LookPath(names[backend])
+	if err != nil {
+		log.Debug().Err(err).Msgf("%s builder binary not found", backend)
+	}
+
+	s.Builder = Builder{Backend: backend, Binary: binary, Host: host}
+	return s
+}
+
+// cli is the binary managing local images, podman stands in for docker when it is the builder.
+func (s Service) cli() string {
+	if s.Builder.Backend == "podman" {
+		return s.Builder.Binary
+	}
+	return s.Binary
 }
 
 func (s Service) Login(ctx context.Context, registryUrl, username, password string) error {
-	cmd := exec.CommandContext(ctx, s.Binary, "login", "--username", username, "--password", password, registryUrl)
+	cmd := exec.CommandContext(ctx, s.cli(), "login", "--username", username, "--password", password, registryUrl)
 	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
@@ -54,7 +110,7 @@ func (s Service) Login(ctx context.Context, registryUrl, username, password stri
 
 func (s Service) InspectByTag(ctx context.Context, registryUrl, repository, tag string) (types.ImageInspect, error) {
 	image := registryUrl + "/" + repository + ":" + tag
-	cmd := exec.CommandContext(ctx, s.Binary, "image", "inspect", image)
+	cmd := exec.CommandContext(ctx, s.cli(), "image", "inspect", image)
 	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 
@@ -79,9 +135,13 @@ func (s Service) InspectByTag(ctx context.Context, registryUrl, repository, tag
 	return inspectData[0], nil
 }
 
-func (s Service) Build(ctx context.Context, functionPath, contextPath string, labels map[string]string, tags []string) error {
+func (s Service) Build(ctx context.Context, i BuildInput) error {
 	var envs []string
 
+	if s.Builder.Binary == "" {
+		return fmt.Errorf("%s builder not found on PATH", s.Builder.Backend)
+	}
+
 	for _, env := range os.Environ() {
 		if !strings.HasPrefix(env, "OTEL_") {
 			envs = append(envs, env)
@@ -90,35 +150,150 @@ func (s Service) Build(ctx context.Context, functionPath, contextPath string, la
 
 	envs = append(envs, "DOCKER_BUILDKIT=1")
 
+	var args []string
+	switch s.Builder.Backend {
+	case "buildkit":
+		args = buildctlArgs(s.Builder.Host, i)
+	case "buildx":
+		args = append([]string{"buildx"}, buildArgs(i)...)
+		args = append(args, cacheArgs("buildx", i)...)
+		args = append(args, buildxOutput(i)...)
+		args = append(args, i.ContextPath)
+	case "podman":
+		args = append(buildArgs(i), cacheArgs("podman", i)...)
+		args = append(args, "--format", "docker", i.ContextPath)
+	default:
+		args = append(buildArgs(i), cacheArgs("docker", i)...)
+		args = append(args, i.ContextPath)
+	}
+
+	cmd := exec.CommandContext(ctx, s.Builder.Binary, args...)
+	cmd.Env = envs
+	cmd.Stderr = os.Stderr
+
+	_, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// buildArgs are the `build` flags docker, buildx and podman have in common, less the context.
+func buildArgs(i BuildInput) []string {
 	args := []string{
 		"build",
-		"-f", functionPath + "/Dockerfile",
+		"-f", i.FunctionPath + "/Dockerfile",
 	}
 
-	for _, tag := range tags {
+	if i.Platform != "" {
+		args = append(args, "--platform", i.Platform)
+	}
+
+	for _, tag := range i.Tags {
 		args = append(args, "-t", tag)
 	}
 
-	for key, value := range labels {
+	for key, value := range i.Labels {
 		args = append(args, "--label", fmt.Sprintf("%s=%s", key, value))
 	}
 
-	args = append(args, contextPath)
+	for key, value := range i.BuildArgs {
+		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, value))
+	}
 
-	cmd := exec.CommandContext(ctx, s.Binary, args...)
-	cmd.Env = envs
-	cmd.Stderr = os.Stderr
+	for _, secret := range i.Secrets {
+		args = append(args, "--secret", secret)
+	}
 
-	_, err := cmd.Output()
-	if err != nil {
-		return err
+	if i.Ssh {
+		args = append(args, "--ssh", "default")
 	}
 
-	return nil
+	return args
+}
+
+// cacheArgs export layers to the cache ref where the backend can. The docker driver cannot export a
+// registry cache, so plain docker embeds inline cache metadata and reuses the previous image of the branch.
+func cacheArgs(backend string, i BuildInput) []string {
+	if i.Cache == "" {
+		return nil
+	}
+
+	switch backend {
+	case "buildx":
+		return []string{
+			"--cache-from", "type=registry,ref=" + i.Cache,
+			"--cache-to", "type=registry,ref=" + i.Cache + ",mode=max,image-manifest=true,oci-mediatypes=true",
+		}
+	case "docker":
+		args := []string{"--build-arg", "BUILDKIT_INLINE_CACHE=1"}
+		for _, tag := range i.Tags {
+			args = append(args, "--cache-from", tag)
+		}
+		return args
+	default:
+		log.Warn().Msgf("%s builder does not support registry caching, building without cache", backend)
+		return nil
+	}
+}
+
+// buildxOutput loads single platform images into docker. The image store cannot load an index of several
+// platforms, so those are written as an OCI archive instead.
+func buildxOutput(i BuildInput) []string {
+	if i.Output != "" {
+		return []string{"--output", "type=oci,dest=" + i.Output}
+	}
+	return []string{"--load"}
+}
+
+func buildctlArgs(host string, i BuildInput) []string {
+	var args []string
+
+	if host != "" {
+		args = append(args, "--addr", host)
+	}
+
+	args = append(args,
+		"build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context="+i.ContextPath,
+		"--local", "dockerfile="+i.FunctionPath,
+		"--opt", "filename=Dockerfile",
+	)
+
+	if i.Platform != "" {
+		args = append(args, "--opt", "platform="+i.Platform)
+	}
+
+	for key, value := range i.Labels {
+		args = append(args, "--opt", fmt.Sprintf("label:%s=%s", key, value))
+	}
+
+	for key, value := range i.BuildArgs {
+		args = append(args, "--opt", fmt.Sprintf("build-arg:%s=%s", key, value))
+	}
+
+	for _, secret := range i.Secrets {
+		args = append(args, "--secret", secret)
+	}
+
+	if i.Ssh {
+		args = append(args, "--ssh", "default")
+	}
+
+	if i.Cache != "" {
+		args = append(args,
+			"--import-cache", "type=registry,ref="+i.Cache,
+			"--export-cache", "type=registry,ref="+i.Cache+",mode=max,image-manifest=true,oci-mediatypes=true",
+		)
+	}
+
+	return append(args, "--output", "type=oci,dest="+i.Output)
 }
 
 func (s Service) Push(ctx context.Context, tag string) error {
-	cmd := exec.CommandContext(ctx, s.Binary, "push", tag)
+	cmd := exec.CommandContext(ctx, s.cli(), "push", tag)
 	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
@@ -131,11 +306,15 @@ func (s Service) Push(ctx context.Context, tag string) error {
 }
 
 func (s Service) Deploy(ctx context.Context, i DeployInput) error {
+	if i.Port == 0 {
+		i.Port = 9000
+	}
+
 	argv := []string{
 		"run",
 		"--rm",
 		"-v", filepath.Dir(i.RiePath) + ":/.aws-lambda-rie",
-		"-p", "9000:8080",
+		"-p", fmt.Sprintf("%d:8080", i.Port),
 		"--env", "AWS_DEFAULT_REGION=" + i.Region,
 		"--env", "AWS_ACCESS_KEY_ID=" + i.AccessKeyId,
 		"--env", "AWS_SECRET_ACCESS_KEY=" + i.SecretAccessKey,
@@ -147,7 +326,11 @@ func (s Service) Deploy(ctx context.Context, i DeployInput) error {
 
 	argv = append(argv, i.Command...)
 
-	cmd := exec.CommandContext(ctx, s.Binary, argv...)
+	cmd := exec.CommandContext(ctx, s.cli(), argv...)
+	cmd.Cancel = func() error {
+		// docker run proxies the interrupt to the container, which then removes itself.
+		return cmd.Process.Signal(os.Interrupt)
+	}
 	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
@@ -20,6 +20,8 @@ type EventBridgeClient interface {
 	ListEventBuses(ctx context.Context, params *eventbridge.ListEventBusesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListEventBusesOutput, error)
 	ListRules(ctx context.Context, params *eventbridge.ListRulesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListRulesOutput, error)
 	ListTargetsByRule(ctx context.Context, params *eventbridge.ListTargetsByRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListTargetsByRuleOutput, error)
+	ListRuleNamesByTarget(ctx context.Context, params *eventbridge.ListRuleNamesByTargetInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListRuleNamesByTargetOutput, error)
+	DescribeRule(ctx context.Context, params *eventbridge.DescribeRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error)
 	PutRule(ctx context.Context, params *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error)
 	PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error)
 	RemoveTargets(ctx context.Context, params *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error)
@@ -56,37 +58,89 @@ func FromClients(eventBridge EventBridgeClient, lambdaClient LambdaClient) Servi
 	}
 }
 
+// List joins every rule target on every bus in the account. Prefer ListByTarget when the target is known.
 func (s Service) List(ctx context.Context) ([]JoinedRule, error) {
 	var results []JoinedRule
 
-	buses, err := s.Client.EventBridge.ListEventBuses(ctx, nil)
+	buses, err := s.listEventBuses(ctx)
 	if err != nil {
 		return []JoinedRule{}, err
 	}
 
-	for _, bus := range buses.EventBuses {
-		rules, err := s.Client.EventBridge.ListRules(ctx, &eventbridge.ListRulesInput{
-			EventBusName: bus.Name,
-		})
+	for _, bus := range buses {
+		rules, err := s.listRules(ctx, bus.Name)
+		if err != nil {
+			return []JoinedRule{}, err
+		}
+
+		for _, rule := range rules {
+			ruleTargets, err := s.listTargetsByRule(ctx, bus.Name, rule.Name)
+			if err != nil {
+				return []JoinedRule{}, err
+			}
+
+			for _, target := range ruleTargets {
+				results = append(results, JoinedRule{
+					Bus:    bus,
+					Rule:   rule,
+					Target: target,
+				})
+			}
+		}
+	}
 
+	return results, nil
+}
+
+// ListByTarget joins the rules targeting the given arn, looked up per bus with ListRuleNamesByTarget
+// so the cost grows with the target's subscriptions rather than with the account.
+func (s Service) ListByTarget(ctx context.Context, targetArn string) ([]JoinedRule, error) {
+	var results []JoinedRule
+
+	buses, err := s.listEventBuses(ctx)
+	if err != nil {
+		return []JoinedRule{}, err
+	}
+
+	for _, bus := range buses {
+		ruleNames, err := s.listRuleNamesByTarget(ctx, bus.Name, targetArn)
 		if err != nil {
 			return []JoinedRule{}, err
 		}
 
-		for _, rule := range rules.Rules {
-			ruleTargets, err := s.Client.EventBridge.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{
+		for _, ruleName := range ruleNames {
+			rule, err := s.Client.EventBridge.DescribeRule(ctx, &eventbridge.DescribeRuleInput{
 				EventBusName: bus.Name,
-				Rule:         rule.Name,
+				Name:         aws.String(ruleName),
 			})
 
 			if err != nil {
 				return []JoinedRule{}, err
 			}
 
-			for _, target := range ruleTargets.Targets {
+			ruleTargets, err := s.listTargetsByRule(ctx, bus.Name, rule.Name)
+			if err != nil {
+				return []JoinedRule{}, err
+			}
+
+			for _, target := range ruleTargets {
+				if aws.ToString(target.Arn) != targetArn {
+					continue
+				}
+
 				results = append(results, JoinedRule{
-					Bus:    bus,
-					Rule:   rule,
+					Bus: bus,
+					Rule: types.Rule{
+						Arn:                rule.Arn,
+						Description:        rule.Description,
+						EventBusName:       rule.EventBusName,
+						EventPattern:       rule.EventPattern,
+						ManagedBy:          rule.ManagedBy,
+						Name:               rule.Name,
+						RoleArn:            rule.RoleArn,
+						ScheduleExpression: rule.ScheduleExpression,
+						State:              rule.State,
+					},
 					Target: target,
 				})
 			}
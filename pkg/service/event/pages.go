@@ -0,0 +1,100 @@
+package event
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// The eventbridge client ships no paginators, these follow NextToken by hand.
+
+func (s Service) listEventBuses(ctx context.Context) ([]types.EventBus, error) {
+	var buses []types.EventBus
+	var nextToken *string
+
+	for {
+		page, err := s.Client.EventBridge.ListEventBuses(ctx, &eventbridge.ListEventBusesInput{
+			NextToken: nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		buses = append(buses, page.EventBuses...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return buses, nil
+		}
+	}
+}
+
+func (s Service) listRules(ctx context.Context, busName *string) ([]types.Rule, error) {
+	var rules []types.Rule
+	var nextToken *string
+
+	for {
+		page, err := s.Client.EventBridge.ListRules(ctx, &eventbridge.ListRulesInput{
+			EventBusName: busName,
+			NextToken:    nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, page.Rules...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return rules, nil
+		}
+	}
+}
+
+func (s Service) listRuleNamesByTarget(ctx context.Context, busName *string, targetArn string) ([]string, error) {
+	var ruleNames []string
+	var nextToken *string
+
+	for {
+		page, err := s.Client.EventBridge.ListRuleNamesByTarget(ctx, &eventbridge.ListRuleNamesByTargetInput{
+			EventBusName: busName,
+			TargetArn:    aws.String(targetArn),
+			NextToken:    nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		ruleNames = append(ruleNames, page.RuleNames...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return ruleNames, nil
+		}
+	}
+}
+
+func (s Service) listTargetsByRule(ctx context.Context, busName, ruleName *string) ([]types.Target, error) {
+	var targets []types.Target
+	var nextToken *string
+
+	for {
+		page, err := s.Client.EventBridge.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{
+			EventBusName: busName,
+			Rule:         ruleName,
+			NextToken:    nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, page.Targets...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return targets, nil
+		}
+	}
+}
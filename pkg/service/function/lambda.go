@@ -10,6 +10,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	types "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	taggingtypes "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
 	"github.com/aws/smithy-go"
 	"github.com/rs/zerolog/log"
 )
@@ -20,22 +22,44 @@ const (
 	longRetry  = 21
 )
 
+// List returns every function deployed by self whose name starts with prefix. Deployments are found by
+// the Function tag self puts on them, through the tagging API, so listing costs the number of deployments
+// rather than paging through every function in the account. Only matching functions are fetched in full.
 func (s Service) List(ctx context.Context, prefix string) ([]lambda.GetFunctionOutput, error) {
 	var functions []lambda.GetFunctionOutput
 
-	listFunctionsInput := &lambda.ListFunctionsInput{}
-	listFunctionsOutput, err := s.Client.Lambda.ListFunctions(ctx, listFunctionsInput)
-	if err != nil {
-		return nil, err
-	}
+	paginator := resourcegroupstaggingapi.NewGetResourcesPaginator(s.Client.Tagging, &resourcegroupstaggingapi.GetResourcesInput{
+		ResourceTypeFilters: []string{"lambda:function"},
+		TagFilters: []taggingtypes.TagFilter{
+			{Key: aws.String("Function")},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, mapping := range page.ResourceTagMappingList {
+			arn := aws.ToString(mapping.ResourceARN)
+			name := arn[strings.LastIndex(arn, ":")+1:]
+
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+
+			getFunctionOutput, err := s.Client.Lambda.GetFunction(ctx, &lambda.GetFunctionInput{
+				FunctionName: aws.String(name),
+			})
 
-	for _, function := range listFunctionsOutput.Functions {
-		if strings.HasPrefix(*function.FunctionName, prefix) {
-			getFunctionInput := &lambda.GetFunctionInput{
-				FunctionName: function.FunctionName,
+			// The tagging API lags behind deletions.
+			var notFound *types.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				log.Debug().Msgf("skipping %s, deleted since it was tagged", name)
+				continue
 			}
 
-			getFunctionOutput, err := s.Client.Lambda.GetFunction(ctx, getFunctionInput)
 			if err != nil {
 				return nil, err
 			}
@@ -74,11 +98,15 @@ func (s Service) PutFunction(ctx context.Context, put *lambda.CreateFunctionInpu
 			MemorySize:   put.MemorySize,
 			Timeout:      put.Timeout,
 			VpcConfig:    put.VpcConfig,
+			Runtime:      put.Runtime,
+			Handler:      put.Handler,
 		}
 
 		patchCode := &lambda.UpdateFunctionCodeInput{
 			FunctionName:  put.FunctionName,
 			ImageUri:      put.Code.ImageUri,
+			S3Bucket:      put.Code.S3Bucket,
+			S3Key:         put.Code.S3Key,
 			Architectures: put.Architectures,
 			Publish:       true,
 		}
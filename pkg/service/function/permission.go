@@ -0,0 +1,90 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/smithy-go"
+)
+
+// Permission is an invoke grant in a function's resource policy, scoped to a source arn.
+type Permission struct {
+	Sid       string
+	Principal string
+	SourceArn string
+}
+
+type policyDocument struct {
+	Statement []struct {
+		Sid       string
+		Principal struct {
+			Service string
+		}
+		Condition struct {
+			ArnLike map[string]string
+		}
+	}
+}
+
+// ListPermissions reads the invoke grants of the function's resource policy.
+func (s Service) ListPermissions(ctx context.Context, functionName string) ([]Permission, error) {
+	var apiErr smithy.APIError
+	var document policyDocument
+	var permissions []Permission
+
+	policy, err := s.Client.Lambda.GetPolicy(ctx, &lambda.GetPolicyInput{
+		FunctionName: aws.String(functionName),
+	})
+
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ResourceNotFoundException" {
+		return []Permission{}, nil
+	}
+
+	if err != nil {
+		return []Permission{}, err
+	}
+
+	if err := json.Unmarshal([]byte(*policy.Policy), &document); err != nil {
+		return []Permission{}, err
+	}
+
+	for _, statement := range document.Statement {
+		permissions = append(permissions, Permission{
+			Sid:       statement.Sid,
+			Principal: statement.Principal.Service,
+			SourceArn: statement.Condition.ArnLike["AWS:SourceArn"],
+		})
+	}
+
+	return permissions, nil
+}
+
+func (s Service) AddPermission(ctx context.Context, functionName string, permission Permission) error {
+	_, err := s.Client.Lambda.AddPermission(ctx, &lambda.AddPermissionInput{
+		Action:       aws.String("lambda:InvokeFunction"),
+		FunctionName: aws.String(functionName),
+		Principal:    aws.String(permission.Principal),
+		SourceArn:    aws.String(permission.SourceArn),
+		StatementId:  aws.String(permission.Sid),
+	})
+
+	return err
+}
+
+func (s Service) RemovePermission(ctx context.Context, functionName, sid string) error {
+	var apiErr smithy.APIError
+
+	_, err := s.Client.Lambda.RemovePermission(ctx, &lambda.RemovePermissionInput{
+		FunctionName: aws.String(functionName),
+		StatementId:  aws.String(sid),
+	})
+
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ResourceNotFoundException" {
+		return nil
+	}
+
+	return err
+}
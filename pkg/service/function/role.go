@@ -18,10 +18,23 @@ func (s Service) GetRole(ctx context.Context, name string) (*iam.GetRoleOutput,
 }
 
 func (s Service) GetRolePolicies(ctx context.Context, name string) (*iam.ListAttachedRolePoliciesOutput, error) {
+	output := &iam.ListAttachedRolePoliciesOutput{}
+
 	getRolePoliciesInput := &iam.ListAttachedRolePoliciesInput{
 		RoleName: aws.String(name),
 	}
-	return s.Client.Iam.ListAttachedRolePolicies(ctx, getRolePoliciesInput)
+
+	paginator := iam.NewListAttachedRolePoliciesPaginator(s.Client.Iam, getRolePoliciesInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		output.AttachedPolicies = append(output.AttachedPolicies, page.AttachedPolicies...)
+	}
+
+	return output, nil
 }
 
 func (s Service) DeleteRole(ctx context.Context, name string) (*iam.DeleteRoleOutput, error) {
@@ -0,0 +1,130 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/rs/zerolog/log"
+)
+
+// PruneVersions deletes published versions of a function beyond the newest keep versions, keep being at least 1.
+// Versions referenced by an alias (including weighted routing) or by provisioned concurrency are never deleted.
+func (s Service) PruneVersions(ctx context.Context, name string, keep int) ([]string, error) {
+	var pruned []string
+
+	if keep < 1 {
+		return pruned, fmt.Errorf("must keep at least 1 version of %s, got %d", name, keep)
+	}
+
+	referenced, err := s.referencedVersions(ctx, name)
+	if err != nil {
+		return pruned, err
+	}
+
+	versions, err := s.publishedVersions(ctx, name)
+	if err != nil {
+		return pruned, err
+	}
+
+	for i, version := range versions {
+		if i < keep || referenced[version] {
+			continue
+		}
+
+		_, err := s.Client.Lambda.DeleteFunction(ctx, &lambda.DeleteFunctionInput{
+			FunctionName: aws.String(name),
+			Qualifier:    aws.String(version),
+		})
+
+		if err != nil {
+			return pruned, err
+		}
+
+		log.Info().Msgf("Function %s version %s pruned", name, version)
+		pruned = append(pruned, version)
+	}
+
+	return pruned, nil
+}
+
+// Numbered versions of a function, newest first.
+func (s Service) publishedVersions(ctx context.Context, name string) ([]string, error) {
+	var numbers []int
+
+	paginator := lambda.NewListVersionsByFunctionPaginator(s.Client.Lambda, &lambda.ListVersionsByFunctionInput{
+		FunctionName: aws.String(name),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return []string{}, err
+		}
+
+		for _, version := range page.Versions {
+			number, err := strconv.Atoi(aws.ToString(version.Version))
+			if err != nil {
+				continue // $LATEST
+			}
+			numbers = append(numbers, number)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+	versions := make([]string, len(numbers))
+	for i, number := range numbers {
+		versions[i] = strconv.Itoa(number)
+	}
+
+	return versions, nil
+}
+
+func (s Service) referencedVersions(ctx context.Context, name string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+
+	aliases := lambda.NewListAliasesPaginator(s.Client.Lambda, &lambda.ListAliasesInput{
+		FunctionName: aws.String(name),
+	})
+
+	for aliases.HasMorePages() {
+		page, err := aliases.NextPage(ctx)
+		if err != nil {
+			return referenced, err
+		}
+
+		for _, alias := range page.Aliases {
+			referenced[aws.ToString(alias.FunctionVersion)] = true
+
+			if alias.RoutingConfig != nil {
+				for version := range alias.RoutingConfig.AdditionalVersionWeights {
+					referenced[version] = true
+				}
+			}
+		}
+	}
+
+	provisioned := lambda.NewListProvisionedConcurrencyConfigsPaginator(s.Client.Lambda, &lambda.ListProvisionedConcurrencyConfigsInput{
+		FunctionName: aws.String(name),
+	})
+
+	for provisioned.HasMorePages() {
+		page, err := provisioned.NextPage(ctx)
+		if err != nil {
+			return referenced, err
+		}
+
+		for _, config := range page.ProvisionedConcurrencyConfigs {
+			arn := aws.ToString(config.FunctionArn)
+			qualifier := arn[strings.LastIndex(arn, ":")+1:]
+			referenced[qualifier] = true
+		}
+	}
+
+	return referenced, nil
+}
@@ -0,0 +1,169 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// fakeLambda serves versions, aliases and provisioned concurrency a page at a time, and records deletions.
+type fakeLambda struct {
+	LambdaClient
+	versions    []string
+	aliases     []types.AliasConfiguration
+	provisioned []string
+	pageSize    int
+	deleted     []string
+}
+
+func (f *fakeLambda) page(marker *string, total int) (int, int, *string) {
+	start := 0
+	if marker != nil {
+		start, _ = strconv.Atoi(*marker)
+	}
+
+	end := min(start+f.pageSize, total)
+	if end < total {
+		return start, end, aws.String(strconv.Itoa(end))
+	}
+
+	return start, end, nil
+}
+
+func (f *fakeLambda) ListVersionsByFunction(ctx context.Context, params *lambda.ListVersionsByFunctionInput, optFns ...func(*lambda.Options)) (*lambda.ListVersionsByFunctionOutput, error) {
+	start, end, next := f.page(params.Marker, len(f.versions))
+
+	output := &lambda.ListVersionsByFunctionOutput{NextMarker: next}
+	for _, version := range f.versions[start:end] {
+		output.Versions = append(output.Versions, types.FunctionConfiguration{Version: aws.String(version)})
+	}
+
+	return output, nil
+}
+
+func (f *fakeLambda) ListAliases(ctx context.Context, params *lambda.ListAliasesInput, optFns ...func(*lambda.Options)) (*lambda.ListAliasesOutput, error) {
+	start, end, next := f.page(params.Marker, len(f.aliases))
+	return &lambda.ListAliasesOutput{Aliases: f.aliases[start:end], NextMarker: next}, nil
+}
+
+func (f *fakeLambda) ListProvisionedConcurrencyConfigs(ctx context.Context, params *lambda.ListProvisionedConcurrencyConfigsInput, optFns ...func(*lambda.Options)) (*lambda.ListProvisionedConcurrencyConfigsOutput, error) {
+	output := &lambda.ListProvisionedConcurrencyConfigsOutput{}
+	for _, version := range f.provisioned {
+		output.ProvisionedConcurrencyConfigs = append(output.ProvisionedConcurrencyConfigs, types.ProvisionedConcurrencyConfigListItem{
+			FunctionArn: aws.String(fmt.Sprintf("arn:aws:lambda:us-east-1:123456789012:function:%s:%s", aws.ToString(params.FunctionName), version)),
+		})
+	}
+
+	return output, nil
+}
+
+func (f *fakeLambda) DeleteFunction(ctx context.Context, params *lambda.DeleteFunctionInput, optFns ...func(*lambda.Options)) (*lambda.DeleteFunctionOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(params.Qualifier))
+	return &lambda.DeleteFunctionOutput{}, nil
+}
+
+// numbered returns $LATEST followed by versions 1 through n, oldest first as Lambda lists them.
+func numbered(n int) []string {
+	versions := []string{"$LATEST"}
+	for i := 1; i <= n; i++ {
+		versions = append(versions, strconv.Itoa(i))
+	}
+	return versions
+}
+
+func TestPruneVersions(t *testing.T) {
+	cases := []struct {
+		name     string
+		fake     fakeLambda
+		keep     int
+		expected []string
+	}{
+		{
+			name:     "keeps the newest versions",
+			fake:     fakeLambda{versions: numbered(5), pageSize: 50},
+			keep:     2,
+			expected: []string{"3", "2", "1"},
+		},
+		{
+			name:     "nothing to prune",
+			fake:     fakeLambda{versions: numbered(3), pageSize: 50},
+			keep:     3,
+			expected: nil,
+		},
+		{
+			name: "aliased and provisioned versions survive",
+			fake: fakeLambda{
+				versions: numbered(6),
+				aliases: []types.AliasConfiguration{
+					{Name: aws.String("live"), FunctionVersion: aws.String("2")},
+					{
+						Name:            aws.String("canary"),
+						FunctionVersion: aws.String("5"),
+						RoutingConfig:   &types.AliasRoutingConfiguration{AdditionalVersionWeights: map[string]float64{"3": 0.1}},
+					},
+				},
+				provisioned: []string{"1"},
+				pageSize:    50,
+			},
+			keep:     2,
+			expected: []string{"4"},
+		},
+		{
+			name: "versions and aliases across pages",
+			fake: fakeLambda{
+				versions: numbered(12),
+				aliases: []types.AliasConfiguration{
+					{Name: aws.String("a"), FunctionVersion: aws.String("1")},
+					{Name: aws.String("b"), FunctionVersion: aws.String("$LATEST")},
+					{Name: aws.String("c"), FunctionVersion: aws.String("7")},
+				},
+				pageSize: 2,
+			},
+			keep:     3,
+			expected: []string{"9", "8", "6", "5", "4", "3", "2"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := tc.fake
+			s := FromClients(&fake, nil, nil)
+
+			pruned, err := s.PruneVersions(context.Background(), "ns-main-api", tc.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(pruned, tc.expected) {
+				t.Errorf("pruned %v, expected %v", pruned, tc.expected)
+			}
+
+			if !slices.Equal(fake.deleted, tc.expected) {
+				t.Errorf("deleted %v, expected %v", fake.deleted, tc.expected)
+			}
+
+			if slices.Contains(fake.deleted, "$LATEST") {
+				t.Error("$LATEST must never be deleted")
+			}
+		})
+	}
+}
+
+func TestPruneVersionsRefusesToKeepNone(t *testing.T) {
+	fake := fakeLambda{versions: numbered(3), pageSize: 50}
+	s := FromClients(&fake, nil, nil)
+
+	if _, err := s.PruneVersions(context.Background(), "ns-main-api", 0); err == nil {
+		t.Fatal("expected keep 0 to be rejected")
+	}
+
+	if len(fake.deleted) != 0 {
+		t.Errorf("deleted %v, expected nothing", fake.deleted)
+	}
+}
@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
+)
+
+// PutAuthorizer creates or updates the authorizer named in the input, returning its id.
+func (s Service) PutAuthorizer(ctx context.Context, input *apigatewayv2.CreateAuthorizerInput) (string, error) {
+	existing, err := s.GetAuthorizerByName(ctx, *input.ApiId, *input.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if existing != nil {
+		updated, err := s.Client.Gw.UpdateAuthorizer(ctx, &apigatewayv2.UpdateAuthorizerInput{
+			ApiId:                          input.ApiId,
+			AuthorizerId:                   existing.AuthorizerId,
+			Name:                           input.Name,
+			AuthorizerType:                 input.AuthorizerType,
+			IdentitySource:                 input.IdentitySource,
+			JwtConfiguration:               input.JwtConfiguration,
+			AuthorizerUri:                  input.AuthorizerUri,
+			AuthorizerPayloadFormatVersion: input.AuthorizerPayloadFormatVersion,
+			AuthorizerResultTtlInSeconds:   input.AuthorizerResultTtlInSeconds,
+			EnableSimpleResponses:          input.EnableSimpleResponses,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return *updated.AuthorizerId, nil
+	}
+
+	created, err := s.Client.Gw.CreateAuthorizer(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	return *created.AuthorizerId, nil
+}
+
+func (s Service) GetAuthorizerByName(ctx context.Context, apiId, name string) (*types.Authorizer, error) {
+	authorizers, err := s.listAuthorizers(ctx, apiId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authorizer := range authorizers {
+		if aws.ToString(authorizer.Name) == name {
+			return &authorizer, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// DeleteAuthorizer removes the named authorizer, if present. It refuses while routes, possibly other
+// functions', still reference it, rather than leave them without authorization.
+func (s Service) DeleteAuthorizer(ctx context.Context, apiId, name string) error {
+	var apiErr smithy.APIError
+
+	existing, err := s.GetAuthorizerByName(ctx, apiId, name)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		return nil
+	}
+
+	routes, err := s.listRoutes(ctx, apiId)
+	if err != nil {
+		return err
+	}
+
+	// Routes switched to NONE or AWS_IAM keep the id of their last authorizer, which no longer applies.
+	var attached []string
+	for _, route := range routes {
+		if route.AuthorizationType != types.AuthorizationTypeJwt && route.AuthorizationType != types.AuthorizationTypeCustom {
+			continue
+		}
+
+		if aws.ToString(route.AuthorizerId) == aws.ToString(existing.AuthorizerId) {
+			attached = append(attached, aws.ToString(route.RouteKey))
+		}
+	}
+
+	if len(attached) > 0 {
+		return fmt.Errorf("authorizer %s is still used by routes %s, remove them or their authorizer first", name, strings.Join(attached, ", "))
+	}
+
+	_, err = s.Client.Gw.DeleteAuthorizer(ctx, &apigatewayv2.DeleteAuthorizerInput{
+		ApiId:        aws.String(apiId),
+		AuthorizerId: existing.AuthorizerId,
+	})
+
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFoundException" {
+		log.Info().Msgf("authorizer %s not found under api %s", name, apiId)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// PutDomainName ensures the custom domain exists, creating it when a certificate is given.
+func (s Service) PutDomainName(ctx context.Context, domainName, certificateArn string) error {
+	var apiErr smithy.APIError
+
+	_, err := s.Client.Gw.GetDomainName(ctx, &apigatewayv2.GetDomainNameInput{
+		DomainName: aws.String(domainName),
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NotFoundException" {
+		return err
+	}
+
+	if certificateArn == "" {
+		return fmt.Errorf("domain %s does not exist, provide a certificateArn to create it", domainName)
+	}
+
+	_, err = s.Client.Gw.CreateDomainName(ctx, &apigatewayv2.CreateDomainNameInput{
+		DomainName: aws.String(domainName),
+		DomainNameConfigurations: []types.DomainNameConfiguration{
+			{
+				CertificateArn: aws.String(certificateArn),
+				EndpointType:   types.EndpointTypeRegional,
+				SecurityPolicy: types.SecurityPolicyTls12,
+			},
+		},
+	})
+
+	return err
+}
+
+// PutApiMapping ensures the base path of the domain maps to the api stage.
+// Mappings are shared by every function mounted under the base path, so an existing mapping is never repointed.
+func (s Service) PutApiMapping(ctx context.Context, apiId, domainName, basePath, stage string) error {
+	mappings, err := s.listApiMappings(ctx, domainName)
+
+	if err != nil {
+		return err
+	}
+
+	for _, mapping := range mappings {
+		if aws.ToString(mapping.ApiMappingKey) != basePath {
+			continue
+		}
+
+		if aws.ToString(mapping.ApiId) != apiId || aws.ToString(mapping.Stage) != stage {
+			return fmt.Errorf("base path %q of domain %s is already mapped to api %s stage %s", basePath, domainName, aws.ToString(mapping.ApiId), aws.ToString(mapping.Stage))
+		}
+
+		return nil
+	}
+
+	_, err = s.Client.Gw.CreateApiMapping(ctx, &apigatewayv2.CreateApiMappingInput{
+		ApiId:         aws.String(apiId),
+		DomainName:    aws.String(domainName),
+		ApiMappingKey: aws.String(basePath),
+		Stage:         aws.String(stage),
+	})
+
+	return err
+}
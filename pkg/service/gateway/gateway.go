@@ -9,9 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
-	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/smithy-go"
-	"github.com/linecard/self/internal/util"
 	"github.com/rs/zerolog/log"
 )
 
@@ -28,56 +26,81 @@ type ApiGatewayV2Client interface {
 	UpdateRoute(ctx context.Context, params *apigatewayv2.UpdateRouteInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.UpdateRouteOutput, error)
 	GetApi(ctx context.Context, params *apigatewayv2.GetApiInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetApiOutput, error)
 	GetApis(ctx context.Context, params *apigatewayv2.GetApisInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetApisOutput, error)
+	GetAuthorizers(ctx context.Context, params *apigatewayv2.GetAuthorizersInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetAuthorizersOutput, error)
+	UpdateAuthorizer(ctx context.Context, params *apigatewayv2.UpdateAuthorizerInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.UpdateAuthorizerOutput, error)
+	UpdateStage(ctx context.Context, params *apigatewayv2.UpdateStageInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.UpdateStageOutput, error)
+	DeleteRouteSettings(ctx context.Context, params *apigatewayv2.DeleteRouteSettingsInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.DeleteRouteSettingsOutput, error)
+	GetDomainName(ctx context.Context, params *apigatewayv2.GetDomainNameInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetDomainNameOutput, error)
+	CreateDomainName(ctx context.Context, params *apigatewayv2.CreateDomainNameInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.CreateDomainNameOutput, error)
+	GetApiMappings(ctx context.Context, params *apigatewayv2.GetApiMappingsInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetApiMappingsOutput, error)
+	CreateApiMapping(ctx context.Context, params *apigatewayv2.CreateApiMappingInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.CreateApiMappingOutput, error)
 	CreateAuthorizer(ctx context.Context, params *apigatewayv2.CreateAuthorizerInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.CreateAuthorizerOutput, error)
 	DeleteAuthorizer(ctx context.Context, params *apigatewayv2.DeleteAuthorizerInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.DeleteAuthorizerOutput, error)
 }
 
-type LambdaClient interface {
-	AddPermission(ctx context.Context, params *lambda.AddPermissionInput, optFns ...func(*lambda.Options)) (*lambda.AddPermissionOutput, error)
-	RemovePermission(ctx context.Context, params *lambda.RemovePermissionInput, optFns ...func(*lambda.Options)) (*lambda.RemovePermissionOutput, error)
-}
-
 type Client struct {
-	Gw     ApiGatewayV2Client
-	Lambda LambdaClient
+	Gw ApiGatewayV2Client
 }
 
 type Service struct {
 	Client Client
 }
 
-func FromClients(gwc ApiGatewayV2Client, lmc LambdaClient) Service {
+func FromClients(gwc ApiGatewayV2Client) Service {
 	return Service{
 		Client: Client{
-			Gw:     gwc,
-			Lambda: lmc,
+			Gw: gwc,
 		},
 	}
 }
 
-func (s Service) PutIntegration(ctx context.Context, apiId, lambdaArn, routeKey string) (*apigatewayv2.GetIntegrationOutput, error) {
-	integrations, err := s.Client.Gw.GetIntegrations(ctx, &apigatewayv2.GetIntegrationsInput{
-		ApiId: aws.String(apiId),
-	})
+// PutIntegration ensures the integration backing a single route of a function.
+// Integrations are one per route, identified by the route key in their description.
+// The forwarded prefix is the public path of the route prefix, which differs from it behind a custom domain base path.
+// Response parameters are keyed by status code, mappings for status codes no longer given are cleared.
+func (s Service) PutIntegration(ctx context.Context, apiId, lambdaArn, routeKey, prefix, forwardedPrefix string, responseParameters map[string]map[string]string) (*apigatewayv2.GetIntegrationOutput, error) {
+	integrations, err := s.listIntegrations(ctx, apiId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	forwardedForPrefix := strings.Split(routeKey, " ")[1]
-	forwardedForPrefix = strings.Replace(forwardedForPrefix, "/{proxy+}", "", 1)
+	requestParameters := map[string]string{
+		"overwrite:path":                      IntegrationPath(routeKey, prefix),
+		"overwrite:header.X-Forwarded-Prefix": forwardedPrefix,
+	}
+
+	for _, integration := range integrations {
+		if aws.ToString(integration.IntegrationUri) != lambdaArn {
+			continue
+		}
+
+		owned := strings.TrimSuffix(aws.ToString(integration.Description), throttleMarker) == routeKey
+		legacy := integration.Description == nil && integration.RequestParameters["overwrite:path"] == requestParameters["overwrite:path"]
+
+		if owned || legacy {
+			updatedResponseParameters := make(map[string]map[string]string)
+			for statusCode := range integration.ResponseParameters {
+				updatedResponseParameters[statusCode] = map[string]string{}
+			}
+
+			for statusCode, parameters := range responseParameters {
+				updatedResponseParameters[statusCode] = parameters
+			}
+
+			description := routeKey
+			if owned {
+				description = aws.ToString(integration.Description)
+			}
 
-	for _, integration := range integrations.Items {
-		if *integration.IntegrationUri == lambdaArn {
 			updated, err := s.Client.Gw.UpdateIntegration(ctx, &apigatewayv2.UpdateIntegrationInput{
 				ApiId:                aws.String(apiId),
 				IntegrationId:        integration.IntegrationId,
 				IntegrationUri:       aws.String(lambdaArn),
+				Description:          aws.String(description),
 				PayloadFormatVersion: aws.String("2.0"),
-				RequestParameters: map[string]string{
-					"overwrite:path":                      "/$request.path.proxy",
-					"overwrite:header.X-Forwarded-Prefix": forwardedForPrefix,
-				},
+				RequestParameters:    requestParameters,
+				ResponseParameters:   updatedResponseParameters,
 			})
 
 			if err != nil {
@@ -95,11 +118,10 @@ func (s Service) PutIntegration(ctx context.Context, apiId, lambdaArn, routeKey
 		ApiId:                aws.String(apiId),
 		IntegrationType:      types.IntegrationTypeAwsProxy,
 		IntegrationUri:       aws.String(lambdaArn),
+		Description:          aws.String(routeKey),
 		PayloadFormatVersion: aws.String("2.0"),
-		RequestParameters: map[string]string{
-			"overwrite:path":                      "/$request.path.proxy",
-			"overwrite:header.X-Forwarded-Prefix": forwardedForPrefix,
-		},
+		RequestParameters:    requestParameters,
+		ResponseParameters:   responseParameters,
 	})
 
 	if err != nil {
@@ -112,6 +134,30 @@ func (s Service) PutIntegration(ctx context.Context, apiId, lambdaArn, routeKey
 	})
 }
 
+// IntegrationPath maps a route onto the path the function sees, relative to the route prefix.
+// Path parameters are forwarded, e.g. "ANY /ns/main/fn/{proxy+}" becomes "/$request.path.proxy".
+func IntegrationPath(routeKey, prefix string) string {
+	path := routeKey
+	if _, after, found := strings.Cut(routeKey, " "); found {
+		path = after
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := strings.TrimSuffix(strings.Trim(segment, "{}"), "+")
+			segments[i] = "$request.path." + name
+		}
+	}
+
+	mapped := strings.Join(segments, "/")
+	if !strings.HasPrefix(mapped, "/") {
+		mapped = "/" + mapped
+	}
+
+	return mapped
+}
+
 func (s Service) PutRoute(ctx context.Context, apiId, integrationId, routeKey string, authType string, authorizerId *string) (*apigatewayv2.GetRouteOutput, error) {
 	var authTypeType types.AuthorizationType
 	switch authType {
@@ -127,15 +173,13 @@ func (s Service) PutRoute(ctx context.Context, apiId, integrationId, routeKey st
 		return nil, fmt.Errorf("unsupported authorization type %s", authType)
 	}
 
-	routes, err := s.Client.Gw.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{
-		ApiId: aws.String(apiId),
-	})
+	routes, err := s.listRoutes(ctx, apiId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	for _, route := range routes.Items {
+	for _, route := range routes {
 		if *route.RouteKey == routeKey {
 			updated, err := s.Client.Gw.UpdateRoute(ctx, &apigatewayv2.UpdateRouteInput{
 				ApiId:             aws.String(apiId),
@@ -175,33 +219,6 @@ func (s Service) PutRoute(ctx context.Context, apiId, integrationId, routeKey st
 	})
 }
 
-func (s Service) PutLambdaPermission(ctx context.Context, apiId, lambdaArn, routeKey string) error {
-	var apiErr smithy.APIError
-
-	accountId := strings.Split(lambdaArn, ":")[4]
-	region := strings.Split(lambdaArn, ":")[3]
-	routePrefix := strings.Split(routeKey, " ")[1]
-	statementId := strings.TrimPrefix("-", util.DeSlasher(routePrefix)+"-api-gw")
-
-	_, err := s.Client.Lambda.AddPermission(ctx, &lambda.AddPermissionInput{
-		Action:       aws.String("lambda:InvokeFunction"),
-		FunctionName: aws.String(lambdaArn),
-		Principal:    aws.String("apigateway.amazonaws.com"),
-		SourceArn:    aws.String("arn:aws:execute-api:" + region + ":" + accountId + ":" + apiId + "/*/*" + routePrefix),
-		StatementId:  aws.String(statementId),
-	})
-
-	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ResourceConflictException" {
-		return nil
-	}
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s Service) DeleteIntegration(ctx context.Context, apiId string, route types.Route) error {
 	var apiErr smithy.APIError
 	var integrationId string
@@ -245,50 +262,32 @@ func (s Service) DeleteRoute(ctx context.Context, apiId string, route types.Rout
 	return nil
 }
 
-func (s Service) DeleteLambdaPermission(ctx context.Context, lambdaArn string, route types.Route) error {
-	var apiErr smithy.APIError
-	routePrefix := strings.Split(*route.RouteKey, " ")[1]
-	statementId := strings.TrimPrefix("-", util.DeSlasher(routePrefix)+"-api-gw")
-
-	_, err := s.Client.Lambda.RemovePermission(ctx, &lambda.RemovePermissionInput{
-		FunctionName: aws.String(lambdaArn),
-		StatementId:  aws.String(statementId),
-	})
-
-	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ResourceNotFoundException" {
-		log.Info().Msgf("no lambda permission not found for route %s", *route.RouteKey)
-		return nil
-	}
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s Service) GetApi(ctx context.Context, apiId string) (*apigatewayv2.GetApiOutput, error) {
 	return s.Client.Gw.GetApi(ctx, &apigatewayv2.GetApiInput{
 		ApiId: aws.String(apiId),
 	})
 }
 
+// GetApis returns every api in the account, gathered from all pages into a single output.
 func (s Service) GetApis(ctx context.Context) (*apigatewayv2.GetApisOutput, error) {
-	return s.Client.Gw.GetApis(ctx, &apigatewayv2.GetApisInput{})
+	apis, err := s.listApis(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apigatewayv2.GetApisOutput{Items: apis}, nil
 }
 
 func (s Service) GetRouteByRouteKey(ctx context.Context, apiId, routeKey string) (types.Route, error) {
 	var matches []types.Route
 
-	routes, err := s.Client.Gw.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{
-		ApiId: aws.String(apiId),
-	})
+	routes, err := s.listRoutes(ctx, apiId)
 
 	if err != nil {
 		return types.Route{}, err
 	}
 
-	for _, route := range routes.Items {
+	for _, route := range routes {
 		if *route.RouteKey == routeKey {
 			matches = append(matches, route)
 		}
@@ -309,31 +308,27 @@ func (s Service) GetRoutesByFunctionArn(ctx context.Context, apiId, functionArn
 	var associatedIntegrations []types.Integration
 	var integratedRoutes []types.Route
 
-	routes, err := s.Client.Gw.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{
-		ApiId: aws.String(apiId),
-	})
+	routes, err := s.listRoutes(ctx, apiId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	integrations, err := s.Client.Gw.GetIntegrations(ctx, &apigatewayv2.GetIntegrationsInput{
-		ApiId: aws.String(apiId),
-	})
+	integrations, err := s.listIntegrations(ctx, apiId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	for _, integration := range integrations.Items {
-		if *integration.IntegrationUri == functionArn {
+	for _, integration := range integrations {
+		if aws.ToString(integration.IntegrationUri) == functionArn {
 			associatedIntegrations = append(associatedIntegrations, integration)
 		}
 	}
 
 	for _, integration := range associatedIntegrations {
-		for _, route := range routes.Items {
-			routeIntegrationId := strings.TrimPrefix(*route.Target, "integrations/")
+		for _, route := range routes {
+			routeIntegrationId := strings.TrimPrefix(aws.ToString(route.Target), "integrations/")
 			if routeIntegrationId == *integration.IntegrationId {
 				integratedRoutes = append(integratedRoutes, route)
 			}
@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+)
+
+// The apigatewayv2 client ships no paginators, these follow NextToken by hand.
+
+func (s Service) listApis(ctx context.Context) ([]types.Api, error) {
+	var apis []types.Api
+	var nextToken *string
+
+	for {
+		page, err := s.Client.Gw.GetApis(ctx, &apigatewayv2.GetApisInput{
+			NextToken: nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		apis = append(apis, page.Items...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return apis, nil
+		}
+	}
+}
+
+func (s Service) listRoutes(ctx context.Context, apiId string) ([]types.Route, error) {
+	var routes []types.Route
+	var nextToken *string
+
+	for {
+		page, err := s.Client.Gw.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{
+			ApiId:     aws.String(apiId),
+			NextToken: nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		routes = append(routes, page.Items...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return routes, nil
+		}
+	}
+}
+
+func (s Service) listIntegrations(ctx context.Context, apiId string) ([]types.Integration, error) {
+	var integrations []types.Integration
+	var nextToken *string
+
+	for {
+		page, err := s.Client.Gw.GetIntegrations(ctx, &apigatewayv2.GetIntegrationsInput{
+			ApiId:     aws.String(apiId),
+			NextToken: nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		integrations = append(integrations, page.Items...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return integrations, nil
+		}
+	}
+}
+
+func (s Service) listAuthorizers(ctx context.Context, apiId string) ([]types.Authorizer, error) {
+	var authorizers []types.Authorizer
+	var nextToken *string
+
+	for {
+		page, err := s.Client.Gw.GetAuthorizers(ctx, &apigatewayv2.GetAuthorizersInput{
+			ApiId:     aws.String(apiId),
+			NextToken: nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		authorizers = append(authorizers, page.Items...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return authorizers, nil
+		}
+	}
+}
+
+func (s Service) listApiMappings(ctx context.Context, domainName string) ([]types.ApiMapping, error) {
+	var mappings []types.ApiMapping
+	var nextToken *string
+
+	for {
+		page, err := s.Client.Gw.GetApiMappings(ctx, &apigatewayv2.GetApiMappingsInput{
+			DomainName: aws.String(domainName),
+			NextToken:  nextToken,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		mappings = append(mappings, page.Items...)
+
+		if nextToken = page.NextToken; aws.ToString(nextToken) == "" {
+			return mappings, nil
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
+)
+
+// throttleMarker is appended to the description of the integration behind a route self throttled,
+// so route settings an administrator set by hand are left alone when no throttle is declared.
+const throttleMarker = " (throttled)"
+
+// PutRouteThrottle sets the stage throttling limits of a single route, leaving other routes untouched,
+// and marks the route's integration as throttled by self.
+func (s Service) PutRouteThrottle(ctx context.Context, apiId, stage string, integration *apigatewayv2.GetIntegrationOutput, routeKey string, burst int32, rate float64) error {
+	_, err := s.Client.Gw.UpdateStage(ctx, &apigatewayv2.UpdateStageInput{
+		ApiId:     aws.String(apiId),
+		StageName: aws.String(stage),
+		RouteSettings: map[string]types.RouteSettings{
+			routeKey: {
+				ThrottlingBurstLimit: aws.Int32(burst),
+				ThrottlingRateLimit:  aws.Float64(rate),
+			},
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return s.markThrottled(ctx, apiId, integration, routeKey, true)
+}
+
+// ResetRouteThrottle removes the stage route settings of a route no longer throttled, but only where
+// self throttled it before.
+func (s Service) ResetRouteThrottle(ctx context.Context, apiId, stage string, integration *apigatewayv2.GetIntegrationOutput, routeKey string) error {
+	if !strings.HasSuffix(aws.ToString(integration.Description), throttleMarker) {
+		return nil
+	}
+
+	if err := s.DeleteRouteSettings(ctx, apiId, stage, routeKey); err != nil {
+		return err
+	}
+
+	return s.markThrottled(ctx, apiId, integration, routeKey, false)
+}
+
+func (s Service) markThrottled(ctx context.Context, apiId string, integration *apigatewayv2.GetIntegrationOutput, routeKey string, throttled bool) error {
+	description := routeKey
+	if throttled {
+		description += throttleMarker
+	}
+
+	if aws.ToString(integration.Description) == description {
+		return nil
+	}
+
+	_, err := s.Client.Gw.UpdateIntegration(ctx, &apigatewayv2.UpdateIntegrationInput{
+		ApiId:         aws.String(apiId),
+		IntegrationId: integration.IntegrationId,
+		Description:   aws.String(description),
+	})
+
+	return err
+}
+
+func (s Service) DeleteRouteSettings(ctx context.Context, apiId, stage, routeKey string) error {
+	var apiErr smithy.APIError
+
+	_, err := s.Client.Gw.DeleteRouteSettings(ctx, &apigatewayv2.DeleteRouteSettingsInput{
+		ApiId:     aws.String(apiId),
+		StageName: aws.String(stage),
+		RouteKey:  aws.String(routeKey),
+	})
+
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFoundException" {
+		log.Debug().Msgf("no route settings for %s on stage %s of api %s", routeKey, stage, apiId)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package ledger
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Records are keyed by function (partition) and deploy time (sort), written once and never updated.
+func (s Service) Put(ctx context.Context, record Record) error {
+	item := map[string]types.AttributeValue{
+		"Function": &types.AttributeValueMemberS{Value: record.Function},
+		"Deployed": &types.AttributeValueMemberS{Value: record.Deployed.UTC().Format(time.RFC3339Nano)},
+		"Branch":   &types.AttributeValueMemberS{Value: record.Branch},
+		"Sha":      &types.AttributeValueMemberS{Value: record.Sha},
+		"Digest":   &types.AttributeValueMemberS{Value: record.Digest},
+		"Caller":   &types.AttributeValueMemberS{Value: record.Caller},
+		"TraceId":  &types.AttributeValueMemberS{Value: record.TraceId},
+		"Outcome":  &types.AttributeValueMemberS{Value: record.Outcome},
+		"Error":    &types.AttributeValueMemberS{Value: record.Error},
+		"Duration": &types.AttributeValueMemberN{Value: strconv.FormatInt(int64(record.Duration), 10)},
+	}
+
+	_, err := s.Client.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.Table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#deployed)"),
+		ExpressionAttributeNames: map[string]string{
+			"#deployed": "Deployed",
+		},
+	})
+
+	return err
+}
+
+func (s Service) List(ctx context.Context, function string) ([]Record, error) {
+	var records []Record
+
+	paginator := dynamodb.NewQueryPaginator(s.Client.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(s.Table),
+		KeyConditionExpression: aws.String("#function = :function"),
+		ExpressionAttributeNames: map[string]string{
+			"#function": "Function",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":function": &types.AttributeValueMemberS{Value: function},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return []Record{}, err
+		}
+
+		for _, item := range page.Items {
+			record, err := unmarshalRecord(item)
+			if err != nil {
+				return []Record{}, err
+			}
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+func unmarshalRecord(item map[string]types.AttributeValue) (Record, error) {
+	var record Record
+	var err error
+
+	str := func(key string) string {
+		if v, ok := item[key].(*types.AttributeValueMemberS); ok {
+			return v.Value
+		}
+		return ""
+	}
+
+	record.Function = str("Function")
+	record.Branch = str("Branch")
+	record.Sha = str("Sha")
+	record.Digest = str("Digest")
+	record.Caller = str("Caller")
+	record.TraceId = str("TraceId")
+	record.Outcome = str("Outcome")
+	record.Error = str("Error")
+
+	if record.Deployed, err = time.Parse(time.RFC3339Nano, str("Deployed")); err != nil {
+		return Record{}, err
+	}
+
+	if v, ok := item["Duration"].(*types.AttributeValueMemberN); ok {
+		duration, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return Record{}, err
+		}
+		record.Duration = time.Duration(duration)
+	}
+
+	return record, nil
+}
@@ -0,0 +1,73 @@
+package ledger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// FileService appends records to a local JSON lines file. Useful for tests and local development.
+type FileService struct {
+	Path string
+}
+
+func FromPath(path string) FileService {
+	return FileService{Path: path}
+}
+
+func (s FileService) Put(ctx context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s FileService) List(ctx context.Context, function string) ([]Record, error) {
+	var records []Record
+
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return []Record{}, nil
+	}
+
+	if err != nil {
+		return []Record{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return []Record{}, err
+		}
+
+		if record.Function == function {
+			records = append(records, record)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return []Record{}, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Deployed.After(records[j].Deployed)
+	})
+
+	return records, nil
+}
@@ -0,0 +1,56 @@
+package ledger
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileServiceListsNewestFirstByFunction(t *testing.T) {
+	ctx := context.Background()
+	s := FromPath(filepath.Join(t.TempDir(), "history.jsonl"))
+
+	deployed := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Function: "ns-main-api", Sha: "a", Outcome: "Succeeded", Deployed: deployed},
+		{Function: "ns-main-worker", Sha: "b", Outcome: "Succeeded", Deployed: deployed.Add(time.Minute)},
+		{Function: "ns-main-api", Sha: "c", Outcome: "Failed", Error: "boom", Deployed: deployed.Add(2 * time.Minute)},
+	}
+
+	for _, record := range records {
+		if err := s.Put(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listed, err := s.List(ctx, "ns-main-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(listed))
+	}
+
+	if listed[0].Sha != "c" || listed[1].Sha != "a" {
+		t.Errorf("expected newest first, got %s then %s", listed[0].Sha, listed[1].Sha)
+	}
+
+	if listed[0].Error != "boom" {
+		t.Errorf("expected error to round trip, got %q", listed[0].Error)
+	}
+}
+
+func TestFileServiceListsNothingWithoutFile(t *testing.T) {
+	s := FromPath(filepath.Join(t.TempDir(), "missing.jsonl"))
+
+	listed, err := s.List(context.Background(), "ns-main-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 0 {
+		t.Errorf("expected no records, got %d", len(listed))
+	}
+}
@@ -0,0 +1,44 @@
+package ledger
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+type DynamoDBClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+type Record struct {
+	Function string        `json:"function"`
+	Branch   string        `json:"branch"`
+	Sha      string        `json:"sha"`
+	Digest   string        `json:"digest"`
+	Caller   string        `json:"caller"`
+	TraceId  string        `json:"traceId"`
+	Outcome  string        `json:"outcome"`
+	Error    string        `json:"error,omitempty"`
+	Deployed time.Time     `json:"deployed"`
+	Duration time.Duration `json:"duration"`
+}
+
+type Client struct {
+	DynamoDB DynamoDBClient
+}
+
+type Service struct {
+	Client Client
+	Table  string
+}
+
+func FromClients(dynamoClient DynamoDBClient, table string) Service {
+	return Service{
+		Client: Client{
+			DynamoDB: dynamoClient,
+		},
+		Table: table,
+	}
+}
@@ -0,0 +1,106 @@
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// BucketService writes each record as its own JSON object, keyed by function and deploy time, so records
+// are never rewritten. Pair it with S3 Object Lock for a tamper-proof trail.
+type BucketService struct {
+	Client S3Client
+	Bucket string
+}
+
+const bucketPrefix = "history/"
+
+func FromBucket(s3Client S3Client, bucket string) BucketService {
+	return BucketService{
+		Client: s3Client,
+		Bucket: bucket,
+	}
+}
+
+func (s BucketService) Put(ctx context.Context, record Record) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(record)),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String("application/json"),
+	})
+
+	return err
+}
+
+func (s BucketService) List(ctx context.Context, function string) ([]Record, error) {
+	var records []Record
+
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(bucketPrefix + function + "/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return []Record{}, err
+		}
+
+		for _, object := range page.Contents {
+			record, err := s.get(ctx, aws.ToString(object.Key))
+			if err != nil {
+				return []Record{}, err
+			}
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Deployed.After(records[j].Deployed)
+	})
+
+	return records, nil
+}
+
+func (s BucketService) get(ctx context.Context, key string) (Record, error) {
+	var record Record
+
+	object, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return record, err
+	}
+	defer object.Body.Close()
+
+	content, err := io.ReadAll(object.Body)
+	if err != nil {
+		return record, err
+	}
+
+	err = json.Unmarshal(content, &record)
+	return record, err
+}
+
+func (s BucketService) key(record Record) string {
+	return bucketPrefix + record.Function + "/" + record.Deployed.UTC().Format(time.RFC3339Nano) + ".json"
+}
@@ -0,0 +1,328 @@
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	mediaTypeDockerConfig    = "application/vnd.docker.container.image.v1+json"
+	mediaTypeDockerLayerGzip = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Archive is a single image read from an OCI layout or a `docker save` tarball, ready to push.
+type Archive struct {
+	Manifest []byte
+	Config   []byte
+	Layers   []Descriptor
+
+	dir   string
+	blobs string
+	temp  []string
+}
+
+// OpenArchive reads an OCI layout directory, or a tarball of one or of `docker save` output, optionally gzipped.
+// Image indexes resolve to the linux image of the architecture, or the first one when it is empty.
+// Close the archive to remove any extracted files.
+func OpenArchive(path, architecture string) (archive Archive, err error) {
+	defer func() {
+		if err != nil {
+			archive.Close()
+		}
+	}()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	archive.dir = path
+	if !info.IsDir() {
+		if archive.dir, err = os.MkdirTemp("", "self-archive-"); err != nil {
+			return archive, err
+		}
+		archive.temp = append(archive.temp, archive.dir)
+
+		if err = untar(path, archive.dir); err != nil {
+			return archive, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	archive.blobs = filepath.Join(archive.dir, "blobs")
+
+	if _, err = os.Stat(filepath.Join(archive.dir, "index.json")); err == nil {
+		err = archive.readLayout(architecture)
+	} else if _, err = os.Stat(filepath.Join(archive.dir, "manifest.json")); err == nil {
+		err = archive.readDockerSave()
+	} else {
+		err = fmt.Errorf("%s is neither an OCI layout nor a docker save archive", path)
+	}
+
+	return archive, err
+}
+
+func (a Archive) Close() {
+	for _, path := range a.temp {
+		os.RemoveAll(path)
+	}
+}
+
+// Open returns the content of a layer by digest.
+func (a Archive) Open(digest string) (io.ReadCloser, error) {
+	return os.Open(a.blobPath(digest))
+}
+
+func (a Archive) blobPath(digest string) string {
+	algorithm, hash, _ := strings.Cut(digest, ":")
+	return filepath.Join(a.blobs, algorithm, hash)
+}
+
+func (a *Archive) readLayout(architecture string) error {
+	var index ImageIndex
+
+	content, err := os.ReadFile(filepath.Join(a.dir, "index.json"))
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := json.Unmarshal(content, &index); err != nil {
+			return err
+		}
+
+		if index.MediaType != mediaTypeOciIndex && index.MediaType != mediaTypeDockerList && len(index.Manifests) == 0 {
+			break
+		}
+
+		// The layout's own index.json points at the image or index without naming a platform.
+		digest := ""
+		for _, entry := range index.Manifests {
+			if entry.Platform.OS == "" {
+				digest = entry.Digest
+				break
+			}
+		}
+
+		if digest == "" {
+			if digest, err = selectPlatform(index, architecture); err != nil {
+				return fmt.Errorf("layout: %w", err)
+			}
+		}
+
+		if content, err = os.ReadFile(a.blobPath(digest)); err != nil {
+			return err
+		}
+		index = ImageIndex{}
+	}
+
+	var manifest struct {
+		Config Descriptor   `json:"config"`
+		Layers []Descriptor `json:"layers"`
+	}
+
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return err
+	}
+
+	config, err := os.ReadFile(a.blobPath(manifest.Config.Digest))
+	if err != nil {
+		return err
+	}
+
+	a.Manifest = content
+	a.Config = config
+	a.Layers = manifest.Layers
+	return nil
+}
+
+// readDockerSave builds a manifest for the legacy `docker save` format, whose layers are
+// uncompressed tarballs without a manifest. Layers are gzipped into blobs so registries accept them.
+func (a *Archive) readDockerSave() error {
+	var saved []struct {
+		Config string
+		Layers []string
+	}
+
+	content, err := os.ReadFile(filepath.Join(a.dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return err
+	}
+
+	if len(saved) != 1 {
+		return fmt.Errorf("docker save archive must contain exactly one image, found %d", len(saved))
+	}
+
+	// Never write into a directory we were handed, only into our own.
+	if a.blobs, err = os.MkdirTemp("", "self-blobs-"); err != nil {
+		return err
+	}
+	a.temp = append(a.temp, a.blobs)
+
+	config, err := os.ReadFile(filepath.Join(a.dir, saved[0].Config))
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(config)
+	manifest := map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeDockerManifest,
+		"config": Descriptor{
+			MediaType: mediaTypeDockerConfig,
+			Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+			Size:      int64(len(config)),
+		},
+	}
+
+	for _, layer := range saved[0].Layers {
+		descriptor, err := a.gzipBlob(filepath.Join(a.dir, layer))
+		if err != nil {
+			return err
+		}
+		a.Layers = append(a.Layers, descriptor)
+	}
+	manifest["layers"] = a.Layers
+
+	if a.Manifest, err = json.Marshal(manifest); err != nil {
+		return err
+	}
+
+	a.Config = config
+	return nil
+}
+
+func (a *Archive) gzipBlob(path string) (Descriptor, error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer source.Close()
+
+	blobs := filepath.Join(a.blobs, "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		return Descriptor{}, err
+	}
+
+	target, err := os.CreateTemp(blobs, ".layer-*")
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer target.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	writer := gzip.NewWriter(io.MultiWriter(target, hash, counter))
+
+	if _, err := io.Copy(writer, source); err != nil {
+		return Descriptor{}, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return Descriptor{}, err
+	}
+
+	descriptor := Descriptor{
+		MediaType: mediaTypeDockerLayerGzip,
+		Digest:    "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		Size:      counter.n,
+	}
+
+	return descriptor, os.Rename(target.Name(), a.blobPath(descriptor.Digest))
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func untar(path, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = bufio.NewReader(file)
+	if magic, _ := reader.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.Clean("/"+header.Name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(out, archive)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			// docker save links duplicate layers, resolve them within the archive.
+			name := header.Linkname
+			if header.Typeflag == tar.TypeSymlink {
+				name = filepath.Join(filepath.Dir(header.Name), header.Linkname)
+			}
+			linkTarget := filepath.Join(dir, filepath.Clean("/"+name))
+
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			if err := os.Link(linkTarget, target); err != nil {
+				return err
+			}
+		}
+	}
+}
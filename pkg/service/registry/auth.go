@@ -0,0 +1,244 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Credentials authenticate to a distribution registry. Empty credentials still take anonymous bearer tokens
+// from registries that hand them out.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// authTransport answers the registry's authentication challenges. Basic credentials are sent where asked for,
+// bearer tokens are fetched from the realm of the WWW-Authenticate challenge. Either is then reused for
+// later requests to the same repository with the same access.
+type authTransport struct {
+	base        http.RoundTripper
+	credentials Credentials
+
+	mu             sync.Mutex
+	authorizations map[string]string
+}
+
+func newAuthTransport(base http.RoundTripper, credentials Credentials) *authTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &authTransport{
+		base:           base,
+		credentials:    credentials,
+		authorizations: make(map[string]string),
+	}
+}
+
+// authError is a refused or unanswerable challenge, retrying the request won't help.
+type authError struct {
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+func authErrorf(format string, args ...any) error {
+	return &authError{message: fmt.Sprintf(format, args...)}
+}
+
+// withCredentials wraps the client's transport to authenticate with the registry.
+func withCredentials(client *http.Client, credentials Credentials) *http.Client {
+	authenticated := *client
+	authenticated.Transport = newAuthTransport(client.Transport, credentials)
+	return &authenticated
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := authorizationKey(req)
+
+	t.mu.Lock()
+	authorization := t.authorizations[key]
+	t.mu.Unlock()
+
+	first := req
+	if authorization != "" {
+		first = withAuthorization(req, authorization)
+	}
+
+	resp, err := t.base.RoundTrip(first)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	if authorization, err = t.answer(req, challenge); err != nil {
+		return nil, err
+	}
+
+	retry := withAuthorization(req, authorization)
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("%s %s: cannot resend the request body after authenticating", req.Method, req.URL)
+		}
+
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	t.authorizations[key] = authorization
+	t.mu.Unlock()
+
+	return t.base.RoundTrip(retry)
+}
+
+// answer returns the Authorization header satisfying a WWW-Authenticate challenge.
+func (t *authTransport) answer(req *http.Request, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if t.credentials.Username == "" {
+			return "", authErrorf("registry %s requires credentials, set SELF_REGISTRY_USERNAME and SELF_REGISTRY_PASSWORD", req.URL.Host)
+		}
+		return "Basic " + t.basic(), nil
+	case "bearer":
+		return t.token(req, params)
+	default:
+		return "", authErrorf("registry %s asks for unsupported authentication %q", req.URL.Host, challenge)
+	}
+}
+
+// token fetches a bearer token from the challenge's realm, authenticating with the credentials if given.
+func (t *authTransport) token(req *http.Request, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", authErrorf("registry %s gave an invalid token realm %q", req.URL.Host, params["realm"])
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if value := params[key]; value != "" {
+			query.Set(key, value)
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	tokenReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if t.credentials.Username != "" {
+		tokenReq.Header.Set("Authorization", "Basic "+t.basic())
+	}
+
+	resp, err := t.base.RoundTrip(tokenReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if t.credentials.Username == "" {
+			return "", authErrorf("registry %s refused an anonymous token (%s), set SELF_REGISTRY_USERNAME and SELF_REGISTRY_PASSWORD", req.URL.Host, resp.Status)
+		}
+		return "", authErrorf("registry %s refused a token for %s: %s", req.URL.Host, t.credentials.Username, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var issued struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.Unmarshal(body, &issued); err != nil {
+		return "", err
+	}
+
+	if issued.Token == "" {
+		issued.Token = issued.AccessToken
+	}
+
+	if issued.Token == "" {
+		return "", authErrorf("registry %s issued an empty token", req.URL.Host)
+	}
+
+	return "Bearer " + issued.Token, nil
+}
+
+func (t *authTransport) basic() string {
+	return base64.StdEncoding.EncodeToString([]byte(t.credentials.Username + ":" + t.credentials.Password))
+}
+
+// authorizationKey groups requests that share a token: the same repository, read or written.
+func authorizationKey(req *http.Request) string {
+	access := "push"
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		access = "pull"
+	}
+
+	repository := req.URL.Path
+	for _, part := range []string{"/manifests/", "/blobs/", "/tags/"} {
+		if before, _, found := strings.Cut(repository, part); found {
+			repository = before
+			break
+		}
+	}
+
+	return req.URL.Host + repository + " " + access
+}
+
+func withAuthorization(req *http.Request, authorization string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", authorization)
+	return clone
+}
+
+// parseChallenge splits `Bearer realm="https://auth",service="registry",scope="repository:a:pull,push"`
+// into its scheme and parameters. Quoted values may hold commas.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key] = value[1 : end+1]
+			rest = value[end+2:]
+			continue
+		}
+
+		value, rest, _ = strings.Cut(value, ",")
+		params[key] = strings.TrimSpace(value)
+	}
+
+	return scheme, params
+}
@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseChallenge(t *testing.T) {
+	cases := []struct {
+		name      string
+		challenge string
+		scheme    string
+		params    map[string]string
+	}{
+		{
+			name:      "bearer with comma in scope",
+			challenge: `Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:ns/api:pull,push"`,
+			scheme:    "Bearer",
+			params: map[string]string{
+				"realm":   "https://auth.example.com/token",
+				"service": "registry.example.com",
+				"scope":   "repository:ns/api:pull,push",
+			},
+		},
+		{
+			name:      "basic",
+			challenge: `Basic realm="Registry Realm"`,
+			scheme:    "Basic",
+			params:    map[string]string{"realm": "Registry Realm"},
+		},
+		{
+			name:      "unquoted values",
+			challenge: `Bearer realm=https://auth.example.com/token, service=registry`,
+			scheme:    "Bearer",
+			params: map[string]string{
+				"realm":   "https://auth.example.com/token",
+				"service": "registry",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			scheme, params := parseChallenge(tc.challenge)
+			if scheme != tc.scheme {
+				t.Errorf("scheme = %q, want %q", scheme, tc.scheme)
+			}
+			if !reflect.DeepEqual(params, tc.params) {
+				t.Errorf("params = %v, want %v", params, tc.params)
+			}
+		})
+	}
+}
+
+func TestAuthTransportBearer(t *testing.T) {
+	var tokens atomic.Int32
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		if username != "ci" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("scope") != "repository:ns/api:pull" {
+			t.Errorf("token requested for scope %q", r.URL.Query().Get("scope"))
+		}
+
+		tokens.Add(1)
+		w.Write([]byte(`{"token":"t0k3n"}`))
+	})
+
+	mux.HandleFunc("/v2/ns/api/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test",scope="repository:ns/api:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"tags":["main","abc123"]}`))
+	})
+
+	s := FromUrl(server.URL, NewCache("")).WithCredentials(Credentials{Username: "ci", Password: "secret"})
+
+	for i := 0; i < 2; i++ {
+		tags, err := s.tags(context.Background(), "ns/api")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tags, []string{"abc123", "main"}) {
+			t.Fatalf("tags = %v", tags)
+		}
+	}
+
+	if got := tokens.Load(); got != 1 {
+		t.Errorf("fetched %d tokens, want the first reused", got)
+	}
+
+	_, err := FromUrl(server.URL, NewCache("")).tags(context.Background(), "ns/api")
+	if err == nil || !strings.Contains(err.Error(), "anonymous") {
+		t.Errorf("anonymous listing = %v, want a refused anonymous token", err)
+	}
+}
+
+func TestAuthTransportBasicRequiresCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username == "ci" && password == "secret" {
+			w.Write([]byte(`{"tags":["main"]}`))
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := FromUrl(server.URL, NewCache("")).tags(context.Background(), "ns/api")
+	if err == nil || !strings.Contains(err.Error(), "requires credentials") {
+		t.Errorf("listing without credentials = %v, want credentials required", err)
+	}
+
+	tags, err := FromUrl(server.URL, NewCache("")).WithCredentials(Credentials{Username: "ci", Password: "secret"}).tags(context.Background(), "ns/api")
+	if err != nil || !reflect.DeepEqual(tags, []string{"main"}) {
+		t.Errorf("listing with credentials = %v, %v", tags, err)
+	}
+}
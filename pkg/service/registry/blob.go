@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	httpAttempts = 4
+	httpTimeout  = 30 * time.Second
+	httpBackoff  = 500 * time.Millisecond
+)
+
+func defaultHttpClient() *http.Client {
+	return &http.Client{Timeout: httpTimeout}
+}
+
+type httpResponse struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+// fetchBlob downloads a layer from its pre-signed url.
+func (s Service) fetchBlob(ctx context.Context, url string) ([]byte, error) {
+	resp, err := send(ctx, s.Client.Http, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("blob download failed: %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// send performs the request, retrying network errors, throttling and server errors with exponential backoff.
+// Any other response is returned as is for the caller to interpret.
+func send(ctx context.Context, client *http.Client, method, url string, header http.Header) (httpResponse, error) {
+	return sendBody(ctx, client, method, url, header, nil)
+}
+
+// sendBody is send with a request body, opened afresh for every attempt.
+func sendBody(ctx context.Context, client *http.Client, method, url string, header http.Header, open opener) (httpResponse, error) {
+	if client == nil {
+		client = defaultHttpClient()
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, retryable, err := sendOnce(ctx, client, method, url, header, open)
+		if !retryable || attempt == httpAttempts {
+			return resp, err
+		}
+
+		wait := httpBackoff * time.Duration(1<<(attempt-1))
+		log.Debug().Err(err).Msgf("retrying %s %s in %s", method, url, wait)
+
+		select {
+		case <-ctx.Done():
+			return httpResponse{}, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+type opener func() (io.ReadCloser, int64, error)
+
+func sendOnce(ctx context.Context, client *http.Client, method, url string, header http.Header, open opener) (httpResponse, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return httpResponse{}, false, err
+	}
+
+	if open != nil {
+		body, size, err := open()
+		if err != nil {
+			return httpResponse{}, false, err
+		}
+		req.Body = body
+		req.ContentLength = size
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, _, err := open()
+			return body, err
+		}
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var authErr *authError
+		return httpResponse{}, ctx.Err() == nil && !errors.As(err, &authErr), err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return httpResponse{}, true, err
+	}
+
+	response := httpResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return response, true, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+
+	return response, false, nil
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/rs/zerolog/log"
+)
+
+// Cache holds image configs by digest. Digests are content addressed so entries never go stale.
+// Entries live in memory for the life of the process and, when Dir is set, on disk across runs.
+type Cache struct {
+	Dir string
+
+	mu      sync.Mutex
+	entries map[string]dockerTypes.ImageInspect
+}
+
+func NewCache(dir string) *Cache {
+	return &Cache{
+		Dir:     dir,
+		entries: make(map[string]dockerTypes.ImageInspect),
+	}
+}
+
+// releaseKey is the entry of a release by digest. An index digest reads a different image per architecture,
+// so the architecture is part of the key.
+func releaseKey(digest, architecture string) string {
+	if architecture == "" {
+		return "sha256:" + digest
+	}
+	return "sha256:" + digest + "-" + architecture
+}
+
+func (c *Cache) Get(digest string) (dockerTypes.ImageInspect, bool) {
+	if c == nil {
+		return dockerTypes.ImageInspect{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if inspect, ok := c.entries[digest]; ok {
+		return inspect, true
+	}
+
+	if c.Dir == "" {
+		return dockerTypes.ImageInspect{}, false
+	}
+
+	content, err := os.ReadFile(c.path(digest))
+	if err != nil {
+		return dockerTypes.ImageInspect{}, false
+	}
+
+	var inspect dockerTypes.ImageInspect
+	if err := json.Unmarshal(content, &inspect); err != nil {
+		log.Debug().Err(err).Msgf("ignoring unreadable cache entry %s", digest)
+		return dockerTypes.ImageInspect{}, false
+	}
+
+	c.entries[digest] = inspect
+	return inspect, true
+}
+
+// Put stores the entry, disk failures are logged and otherwise ignored since the cache is only an optimization.
+func (c *Cache) Put(digest string, inspect dockerTypes.ImageInspect) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[digest] = inspect
+
+	if c.Dir == "" {
+		return
+	}
+
+	content, err := json.Marshal(inspect)
+	if err != nil {
+		log.Debug().Err(err).Msgf("failed to encode cache entry %s", digest)
+		return
+	}
+
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		log.Debug().Err(err).Msgf("failed to create cache dir %s", c.Dir)
+		return
+	}
+
+	// Write then rename so concurrent processes never read a partial entry.
+	tmp, err := os.CreateTemp(c.Dir, ".entry-*")
+	if err != nil {
+		log.Debug().Err(err).Msgf("failed to write cache entry %s", digest)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		log.Debug().Err(err).Msgf("failed to write cache entry %s", digest)
+		return
+	}
+
+	if err := tmp.Close(); err != nil {
+		log.Debug().Err(err).Msgf("failed to write cache entry %s", digest)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(digest)); err != nil {
+		log.Debug().Err(err).Msgf("failed to write cache entry %s", digest)
+	}
+}
+
+func (c *Cache) path(digest string) string {
+	return filepath.Join(c.Dir, strings.ReplaceAll(digest, ":", "-")+".json")
+}
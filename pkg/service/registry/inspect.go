@@ -4,12 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/smithy-go"
 	dockerTypes "github.com/docker/docker/api/types"
 )
 
@@ -28,6 +27,13 @@ type DistributionManifest struct {
 	} `json:"layers"`
 }
 
+var acceptedMediaTypes = []string{
+	mediaTypeDockerManifest,
+	mediaTypeOciManifest,
+	mediaTypeDockerList,
+	mediaTypeOciIndex,
+}
+
 func (s Service) InspectByTag(ctx context.Context, registryId, repository, tag string) (dockerTypes.ImageInspect, error) {
 	batchGetImageInput := &ecr.BatchGetImageInput{
 		RegistryId:     aws.String(registryId),
@@ -37,6 +43,7 @@ func (s Service) InspectByTag(ctx context.Context, registryId, repository, tag s
 				ImageTag: aws.String(tag),
 			},
 		},
+		AcceptedMediaTypes: acceptedMediaTypes,
 	}
 
 	batchGetImageOutput, err := s.Client.Ecr.BatchGetImage(ctx, batchGetImageInput)
@@ -49,13 +56,18 @@ func (s Service) InspectByTag(ctx context.Context, registryId, repository, tag s
 	}
 
 	if len(batchGetImageOutput.Images) == 0 {
-		return dockerTypes.ImageInspect{}, fmt.Errorf("no such release found for tag %s", tag)
+		return dockerTypes.ImageInspect{}, &smithy.GenericAPIError{Code: "ImageNotFoundException", Message: "no such release found for tag " + tag}
 	}
 
 	return s.inspect(ctx, registryId, repository, batchGetImageOutput)
 }
 
+// InspectByDigest reads the image config of a release, served from the cache when the digest was seen before.
 func (s Service) InspectByDigest(ctx context.Context, registryId, repository, digest string) (dockerTypes.ImageInspect, error) {
+	if inspect, ok := s.Cache.Get(releaseKey(digest, s.Architecture)); ok {
+		return inspect, nil
+	}
+
 	batchGetImageInput := &ecr.BatchGetImageInput{
 		RegistryId:     aws.String(registryId),
 		RepositoryName: aws.String(repository),
@@ -64,6 +76,7 @@ func (s Service) InspectByDigest(ctx context.Context, registryId, repository, di
 				ImageDigest: aws.String("sha256:" + digest),
 			},
 		},
+		AcceptedMediaTypes: acceptedMediaTypes,
 	}
 
 	batchGetImageOutput, err := s.Client.Ecr.BatchGetImage(ctx, batchGetImageInput)
@@ -72,30 +85,64 @@ func (s Service) InspectByDigest(ctx context.Context, registryId, repository, di
 	}
 
 	if len(batchGetImageOutput.Images) == 0 {
-		return dockerTypes.ImageInspect{}, fmt.Errorf("no such release found for digest %s", digest)
+		return dockerTypes.ImageInspect{}, &smithy.GenericAPIError{Code: "ImageNotFoundException", Message: "no such release found for digest " + digest}
 	}
 
 	if len(batchGetImageOutput.Images) > 2 {
 		return dockerTypes.ImageInspect{}, fmt.Errorf("greater than 2 releases found for digest %s", digest)
 	}
 
-	return s.inspect(ctx, registryId, repository, batchGetImageOutput)
+	inspect, err := s.inspect(ctx, registryId, repository, batchGetImageOutput)
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	s.Cache.Put(releaseKey(digest, s.Architecture), inspect)
+	return inspect, nil
 }
 
 func (s Service) inspect(ctx context.Context, registryId, repository string, batchGetImageOutput *ecr.BatchGetImageOutput) (dockerTypes.ImageInspect, error) {
 	var inspect dockerTypes.ImageInspect
 	var distributionManifest DistributionManifest
-	var downloadUrlResp *ecr.GetDownloadUrlForLayerOutput
-	var resp *http.Response
-	var body []byte
 
 	manifestJson := []byte(*batchGetImageOutput.Images[0].ImageManifest)
+
+	// Images pushed by buildx are often indexes, even for one platform, as attestations ride along.
+	// The platform image is read instead, so architecture comes from what was actually pushed.
+	platformDigest, err := platformManifest(manifestJson, s.Architecture)
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	if platformDigest != "" {
+		platformOutput, err := s.Client.Ecr.BatchGetImage(ctx, &ecr.BatchGetImageInput{
+			RegistryId:         aws.String(registryId),
+			RepositoryName:     aws.String(repository),
+			ImageIds:           []ecrTypes.ImageIdentifier{{ImageDigest: aws.String(platformDigest)}},
+			AcceptedMediaTypes: acceptedMediaTypes,
+		})
+
+		if err != nil {
+			return dockerTypes.ImageInspect{}, err
+		}
+
+		if len(platformOutput.Images) == 0 {
+			return dockerTypes.ImageInspect{}, fmt.Errorf("no such image found for digest %s", platformDigest)
+		}
+
+		manifestJson = []byte(*platformOutput.Images[0].ImageManifest)
+	}
+
 	if err := json.Unmarshal(manifestJson, &distributionManifest); err != nil {
 		return dockerTypes.ImageInspect{}, err
 	}
 
 	configDigest := distributionManifest.Config.Digest
 
+	if cached, ok := s.Cache.Get(configDigest); ok {
+		return cached, nil
+	}
+
 	urlInput := &ecr.GetDownloadUrlForLayerInput{
 		RegistryId:     aws.String(registryId),
 		RepositoryName: aws.String(repository),
@@ -107,45 +154,66 @@ func (s Service) inspect(ctx context.Context, registryId, repository string, bat
 		return dockerTypes.ImageInspect{}, err
 	}
 
-	downloadUrl := downloadUrlResp.DownloadUrl
-
-	resp, err = http.Get(*downloadUrl)
+	body, err := s.fetchBlob(ctx, *downloadUrlResp.DownloadUrl)
 	if err != nil {
 		return dockerTypes.ImageInspect{}, err
 	}
 
-	defer resp.Body.Close()
+	if err = json.Unmarshal(body, &inspect); err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
 
-	body, err = io.ReadAll(resp.Body)
+	s.Cache.Put(configDigest, inspect)
+	return inspect, nil
+}
+
+// ImageUri returns the uri Lambda deploys a tag from. When the tag is an image index, as buildx pushes,
+// it names the platform image instead, since Lambda does not accept indexes.
+func (s Service) ImageUri(ctx context.Context, registryId, registryUrl, repository, tag string) (string, error) {
+	image, err := s.tagged(ctx, registryId, repository, tag)
 	if err != nil {
-		return dockerTypes.ImageInspect{}, err
+		return "", err
 	}
 
-	err = json.Unmarshal(body, &inspect)
+	digest := aws.ToString(image.ImageId.ImageDigest)
+
+	platformDigest, err := platformManifest([]byte(aws.ToString(image.ImageManifest)), s.Architecture)
 	if err != nil {
-		return dockerTypes.ImageInspect{}, err
+		return "", err
 	}
 
-	return inspect, nil
+	if platformDigest != "" {
+		digest = platformDigest
+	}
+
+	return registryUrl + "/" + repository + "@" + digest, nil
 }
 
-func (s Service) ImageUri(ctx context.Context, registryId, registryUrl, repository, tag string) (string, error) {
-	input := &ecr.BatchGetImageInput{
-		RegistryId:     aws.String(registryId),
-		RepositoryName: aws.String(repository),
-		ImageIds: []ecrTypes.ImageIdentifier{
-			{
-				ImageTag: aws.String(tag),
-			},
-		},
+// Digest returns the digest a tag points at, that of the index for multi-platform images. Releases are signed under it.
+func (s Service) Digest(ctx context.Context, registryId, repository, tag string) (string, error) {
+	image, err := s.tagged(ctx, registryId, repository, tag)
+	if err != nil {
+		return "", err
 	}
 
-	output, err := s.Client.Ecr.BatchGetImage(ctx, input)
+	return aws.ToString(image.ImageId.ImageDigest), nil
+}
+
+func (s Service) tagged(ctx context.Context, registryId, repository, tag string) (ecrTypes.Image, error) {
+	output, err := s.Client.Ecr.BatchGetImage(ctx, &ecr.BatchGetImageInput{
+		RegistryId:         aws.String(registryId),
+		RepositoryName:     aws.String(repository),
+		ImageIds:           []ecrTypes.ImageIdentifier{{ImageTag: aws.String(tag)}},
+		AcceptedMediaTypes: acceptedMediaTypes,
+	})
+
 	if err != nil {
-		return "", err
+		return ecrTypes.Image{}, err
+	}
+
+	if len(output.Images) == 0 {
+		return ecrTypes.Image{}, &smithy.GenericAPIError{Code: "ImageNotFoundException", Message: "no such release found for tag " + tag}
 	}
 
-	digest := *output.Images[0].ImageId.ImageDigest
-	imageUri := registryUrl + "/" + repository + "@" + digest
-	return imageUri, nil
+	return output.Images[0], nil
 }
@@ -8,7 +8,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 )
 
+// List describes every image in the repository, gathered from all pages into a single output.
 func (s Service) List(ctx context.Context, registryUrl, repositoryName string) (ecr.DescribeImagesOutput, error) {
+	var output ecr.DescribeImagesOutput
+
 	registryId := strings.Split(registryUrl, ".")[0]
 
 	input := &ecr.DescribeImagesInput{
@@ -16,10 +19,15 @@ func (s Service) List(ctx context.Context, registryUrl, repositoryName string) (
 		RepositoryName: aws.String(repositoryName),
 	}
 
-	output, err := s.Client.Ecr.DescribeImages(ctx, input)
-	if err != nil {
-		return ecr.DescribeImagesOutput{}, err
+	paginator := ecr.NewDescribeImagesPaginator(s.Client.Ecr, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return ecr.DescribeImagesOutput{}, err
+		}
+
+		output.ImageDetails = append(output.ImageDetails, page.ImageDetails...)
 	}
 
-	return *output, nil
+	return output, nil
 }
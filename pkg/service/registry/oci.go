@@ -0,0 +1,510 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/smithy-go"
+	dockerTypes "github.com/docker/docker/api/types"
+)
+
+const (
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOciManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOciIndex       = "application/vnd.oci.image.index.v1+json"
+)
+
+type ImageIndex struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	MediaType     string `json:"mediaType"`
+	Manifests     []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Platform  struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// OciService reads and manages releases in a registry speaking the OCI distribution API, such as registry:2.
+// Registry ids are ignored, and errors carry the ECR error codes the conventions already handle.
+type OciService struct {
+	Endpoint    string
+	Http        *http.Client
+	Cache       *Cache
+	Credentials Credentials
+	// Architecture picks the image read from an index, empty takes the first linux image.
+	Architecture string
+}
+
+// FromUrl takes the registry's base url, e.g. http://localhost:5000. Registries handing out anonymous
+// tokens are authenticated against as is, others need WithCredentials.
+func FromUrl(endpoint string, cache *Cache) OciService {
+	return OciService{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Http:     withCredentials(defaultHttpClient(), Credentials{}),
+		Cache:    cache,
+	}
+}
+
+// WithCredentials authenticates with the registry, by basic auth or for its bearer tokens.
+func (s OciService) WithCredentials(credentials Credentials) OciService {
+	s.Credentials = credentials
+	s.Http = withCredentials(defaultHttpClient(), credentials)
+	return s
+}
+
+// WithArchitecture reads the image of this architecture from image indexes, e.g. arm64.
+func (s OciService) WithArchitecture(architecture string) OciService {
+	s.Architecture = architecture
+	return s
+}
+
+func (s OciService) uploadHttpClient() *http.Client {
+	return withCredentials(uploadHttpClient(), s.Credentials)
+}
+
+func (s OciService) InspectByTag(ctx context.Context, registryId, repository, tag string) (dockerTypes.ImageInspect, error) {
+	manifest, _, err := s.manifest(ctx, repository, tag)
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	return s.config(ctx, repository, manifest.Config.Digest)
+}
+
+// InspectByDigest reads the image config of a release, served from the cache when the digest was seen before.
+func (s OciService) InspectByDigest(ctx context.Context, registryId, repository, digest string) (dockerTypes.ImageInspect, error) {
+	if inspect, ok := s.Cache.Get(releaseKey(digest, s.Architecture)); ok {
+		return inspect, nil
+	}
+
+	manifest, _, err := s.manifest(ctx, repository, "sha256:"+digest)
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	inspect, err := s.config(ctx, repository, manifest.Config.Digest)
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	s.Cache.Put(releaseKey(digest, s.Architecture), inspect)
+	return inspect, nil
+}
+
+// ImageUri returns the uri Lambda deploys a tag from, naming the platform image when the tag is an image index.
+func (s OciService) ImageUri(ctx context.Context, registryId, registryUrl, repository, tag string) (string, error) {
+	content, digest, err := s.rawManifest(ctx, repository, tag)
+	if err != nil {
+		return "", err
+	}
+
+	platformDigest, err := platformManifest(content, s.Architecture)
+	if err != nil {
+		return "", err
+	}
+
+	if platformDigest != "" {
+		digest = platformDigest
+	}
+
+	return registryUrl + "/" + repository + "@" + digest, nil
+}
+
+// Digest returns the digest a tag points at, that of the index for multi-platform images. Releases are signed under it.
+func (s OciService) Digest(ctx context.Context, registryId, repository, tag string) (string, error) {
+	_, digest, err := s.rawManifest(ctx, repository, tag)
+	return digest, err
+}
+
+// List describes every tagged image in the repository. The distribution API has no push time,
+// so the image's creation time stands in for it. Tags are resolved to digests with HEAD requests,
+// and each image is only inspected once however many tags it has, from the cache where it was seen before.
+func (s OciService) List(ctx context.Context, registryUrl, repositoryName string) (ecr.DescribeImagesOutput, error) {
+	var output ecr.DescribeImagesOutput
+
+	tags, err := s.tags(ctx, repositoryName)
+	if err != nil {
+		return ecr.DescribeImagesOutput{}, err
+	}
+
+	tagDigests, err := s.digests(ctx, repositoryName, tags)
+	if err != nil {
+		return ecr.DescribeImagesOutput{}, err
+	}
+
+	details := make(map[string]*ecrTypes.ImageDetail)
+	var digests []string
+
+	for i, tag := range tags {
+		digest := tagDigests[i]
+
+		if detail, ok := details[digest]; ok {
+			detail.ImageTags = append(detail.ImageTags, tag)
+			continue
+		}
+
+		inspect, err := s.InspectByDigest(ctx, "", repositoryName, strings.TrimPrefix(digest, "sha256:"))
+		if err != nil {
+			return ecr.DescribeImagesOutput{}, err
+		}
+
+		created, _ := time.Parse(time.RFC3339Nano, inspect.Created)
+
+		details[digest] = &ecrTypes.ImageDetail{
+			ImageDigest:    aws.String(digest),
+			ImageTags:      []string{tag},
+			ImagePushedAt:  aws.Time(created),
+			RepositoryName: aws.String(repositoryName),
+		}
+		digests = append(digests, digest)
+	}
+
+	for _, digest := range digests {
+		output.ImageDetails = append(output.ImageDetails, *details[digest])
+	}
+
+	return output, nil
+}
+
+// listConcurrency bounds the HEAD requests resolving tags in flight at once.
+const listConcurrency = 8
+
+// digests resolves each tag to the digest of its manifest, in order.
+func (s OciService) digests(ctx context.Context, repository string, tags []string) ([]string, error) {
+	digests := make([]string, len(tags))
+	errs := make([]error, len(tags))
+	slots := make(chan struct{}, listConcurrency)
+
+	var wg sync.WaitGroup
+	wg.Add(len(tags))
+
+	for i := range tags {
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			digests[i], errs[i] = s.digest(ctx, repository, tags[i])
+		}(i)
+	}
+
+	wg.Wait()
+	return digests, errors.Join(errs...)
+}
+
+// digest resolves a tag to the digest of its manifest without downloading it, falling back to a
+// GET for registries that leave Docker-Content-Digest off HEAD responses.
+func (s OciService) digest(ctx context.Context, repository, reference string) (string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(acceptedMediaTypes, ", "))
+
+	resp, err := send(ctx, s.Http, http.MethodHead, s.url(repository, "manifests", reference), header)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		_, _, err := s.manifest(ctx, repository, reference)
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", apiError(resp)
+	}
+
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	_, digest, err := s.manifest(ctx, repository, reference)
+	return digest, err
+}
+
+func (s OciService) Delete(ctx context.Context, registryId, repository string, imageDigests []string) error {
+	for _, digest := range imageDigests {
+		resp, err := send(ctx, s.Http, http.MethodDelete, s.url(repository, "manifests", digest), nil)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+			return apiError(resp)
+		}
+	}
+
+	return nil
+}
+
+// Untag deletes the tag where the registry supports it. Registries that only delete by digest, like registry:2,
+// get the manifest deleted instead, provided no other tag still references it.
+func (s OciService) Untag(ctx context.Context, registryId, repository, tag string) error {
+	resp, err := send(ctx, s.Http, http.MethodDelete, s.url(repository, "manifests", tag), nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusMethodNotAllowed {
+		return apiError(resp)
+	}
+
+	_, digest, err := s.manifest(ctx, repository, tag)
+	if err != nil {
+		return err
+	}
+
+	tags, err := s.tags(ctx, repository)
+	if err != nil {
+		return err
+	}
+
+	otherDigests, err := s.digests(ctx, repository, tags)
+	if err != nil {
+		return err
+	}
+
+	for i, other := range tags {
+		if other != tag && otherDigests[i] == digest {
+			return fmt.Errorf("registry cannot delete tag %s alone, %s still references %s", tag, other, digest)
+		}
+	}
+
+	return s.Delete(ctx, registryId, repository, []string{digest})
+}
+
+// PutRepository is a no-op, distribution registries create repositories on first push.
+func (s OciService) PutRepository(ctx context.Context, repositoryName string) error {
+	return nil
+}
+
+func (s OciService) Token(ctx context.Context, registryId string) (string, error) {
+	return "", fmt.Errorf("registry tokens are only issued by ECR, log in to %s with docker login", s.Endpoint)
+}
+
+func (s OciService) ScanFindings(ctx context.Context, registryId, repository, digest string) (*ecr.DescribeImageScanFindingsOutput, error) {
+	return nil, fmt.Errorf("image scanning is only available on ECR, %s does not scan", s.Endpoint)
+}
+
+// manifest resolves a tag or digest to an image manifest and the digest it was found under.
+// Image indexes resolve to the image of the configured architecture, skipping attestation manifests.
+func (s OciService) manifest(ctx context.Context, repository, reference string) (DistributionManifest, string, error) {
+	var manifest DistributionManifest
+
+	content, digest, err := s.rawManifest(ctx, repository, reference)
+	if err != nil {
+		return DistributionManifest{}, "", err
+	}
+
+	platformDigest, err := platformManifest(content, s.Architecture)
+	if err != nil {
+		return DistributionManifest{}, "", err
+	}
+
+	if platformDigest != "" {
+		manifest, _, err := s.manifest(ctx, repository, platformDigest)
+		return manifest, digest, err
+	}
+
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return DistributionManifest{}, "", err
+	}
+
+	return manifest, digest, nil
+}
+
+// rawManifest fetches a manifest or index as pushed, with its digest.
+func (s OciService) rawManifest(ctx context.Context, repository, reference string) ([]byte, string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(acceptedMediaTypes, ", "))
+
+	resp, err := send(ctx, s.Http, http.MethodGet, s.url(repository, "manifests", reference), header)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", apiError(resp)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(resp.Body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	return resp.Body, digest, nil
+}
+
+// platformManifest returns the digest of the image for the architecture when content is an image index,
+// and an empty digest when content is already an image manifest.
+func platformManifest(content []byte, architecture string) (string, error) {
+	var index ImageIndex
+
+	if err := json.Unmarshal(content, &index); err != nil {
+		return "", err
+	}
+
+	isIndex := index.MediaType == mediaTypeOciIndex || index.MediaType == mediaTypeDockerList
+	if !isIndex && (index.MediaType != "" || len(index.Manifests) == 0) {
+		return "", nil
+	}
+
+	return selectPlatform(index, architecture)
+}
+
+// selectPlatform returns the digest of the index's linux image for the architecture, or of its first linux
+// image when no architecture is configured. Attestation manifests, whose platform is unknown, are skipped.
+func selectPlatform(index ImageIndex, architecture string) (string, error) {
+	var available []string
+
+	for _, entry := range index.Manifests {
+		if entry.Platform.OS != "linux" || entry.Platform.Architecture == "unknown" {
+			continue
+		}
+
+		if architecture == "" || entry.Platform.Architecture == architecture {
+			return entry.Digest, nil
+		}
+
+		available = append(available, entry.Platform.Architecture)
+	}
+
+	if len(available) == 0 {
+		return "", fmt.Errorf("no linux image found in index")
+	}
+
+	return "", fmt.Errorf("no linux/%s image found in index, it holds %s", architecture, strings.Join(available, ", "))
+}
+
+func (s OciService) config(ctx context.Context, repository, configDigest string) (dockerTypes.ImageInspect, error) {
+	var inspect dockerTypes.ImageInspect
+
+	if cached, ok := s.Cache.Get(configDigest); ok {
+		return cached, nil
+	}
+
+	resp, err := send(ctx, s.Http, http.MethodGet, s.url(repository, "blobs", configDigest), nil)
+	if err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return dockerTypes.ImageInspect{}, apiError(resp)
+	}
+
+	if err := json.Unmarshal(resp.Body, &inspect); err != nil {
+		return dockerTypes.ImageInspect{}, err
+	}
+
+	s.Cache.Put(configDigest, inspect)
+	return inspect, nil
+}
+
+// tags lists the repository's tags, following the Link header across pages.
+func (s OciService) tags(ctx context.Context, repository string) ([]string, error) {
+	var tags []string
+
+	next := s.url(repository, "tags", "list")
+	for next != "" {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+
+		resp, err := send(ctx, s.Http, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, apiError(resp)
+		}
+
+		if err := json.Unmarshal(resp.Body, &page); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, page.Tags...)
+
+		next, err = s.nextLink(resp.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (s OciService) url(repository string, parts ...string) string {
+	return s.Endpoint + "/v2/" + repository + "/" + strings.Join(parts, "/")
+}
+
+// nextLink resolves a `<url>; rel="next"` header against the endpoint.
+func (s OciService) nextLink(link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+
+	target, _, _ := strings.Cut(link, ";")
+	target = strings.Trim(strings.TrimSpace(target), "<>")
+
+	base, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+// apiError maps distribution error codes onto their ECR equivalents.
+func apiError(resp httpResponse) error {
+	var body struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	code, message := "", resp.Status
+	if json.Unmarshal(resp.Body, &body) == nil && len(body.Errors) > 0 {
+		code, message = body.Errors[0].Code, body.Errors[0].Message
+	}
+
+	switch code {
+	case "NAME_UNKNOWN":
+		code = "RepositoryNotFoundException"
+	case "MANIFEST_UNKNOWN", "BLOB_UNKNOWN":
+		code = "ImageNotFoundException"
+	case "":
+		code = strings.ReplaceAll(http.StatusText(resp.StatusCode), " ", "")
+	}
+
+	return &smithy.GenericAPIError{
+		Code:    code,
+		Message: message,
+	}
+}
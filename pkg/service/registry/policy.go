@@ -0,0 +1,234 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
+)
+
+// Statements and rules self manages are marked, anything else in a repository's policies is left as found.
+const (
+	sidAccountPull   = "SelfAccountPull"
+	sidLambdaPull    = "SelfLambdaPull"
+	expireUntaggedId = "self: expire untagged images"
+)
+
+// Settings are reconciled onto each repository by PutRepository. Zero values leave a policy unmanaged.
+type Settings struct {
+	// PullAccounts may read images, and their Lambda functions pull them.
+	PullAccounts []string
+	// ExpireUntaggedDays expires images this long after they were pushed, once nothing tags them.
+	ExpireUntaggedDays int
+}
+
+type policyDocument struct {
+	Version   string           `json:"Version"`
+	Statement []map[string]any `json:"Statement"`
+}
+
+type lifecyclePolicy struct {
+	Rules []map[string]any `json:"rules"`
+}
+
+func (s Service) WithSettings(settings Settings) Service {
+	s.Settings = settings
+	return s
+}
+
+// putRepositoryPolicy grants the pull accounts read access to the repository, and their Lambda service pulls.
+func (s Service) putRepositoryPolicy(ctx context.Context, repositoryName string) error {
+	if len(s.Settings.PullAccounts) == 0 {
+		return nil
+	}
+
+	var principals, sources []string
+	for _, account := range s.Settings.PullAccounts {
+		principals = append(principals, fmt.Sprintf("arn:aws:iam::%s:root", account))
+		sources = append(sources, fmt.Sprintf("arn:aws:lambda:*:%s:function:*", account))
+	}
+
+	managed := []map[string]any{
+		{
+			"Sid":       sidAccountPull,
+			"Effect":    "Allow",
+			"Principal": map[string]any{"AWS": principals},
+			"Action": []string{
+				"ecr:BatchGetImage",
+				"ecr:GetDownloadUrlForLayer",
+				"ecr:DescribeImages",
+				"ecr:DescribeImageScanFindings",
+			},
+		},
+		{
+			"Sid":       sidLambdaPull,
+			"Effect":    "Allow",
+			"Principal": map[string]any{"Service": "lambda.amazonaws.com"},
+			"Action": []string{
+				"ecr:BatchGetImage",
+				"ecr:GetDownloadUrlForLayer",
+			},
+			"Condition": map[string]any{
+				"StringLike": map[string]any{"aws:sourceArn": sources},
+			},
+		},
+	}
+
+	current := policyDocument{Version: "2012-10-17"}
+
+	existing, err := s.Client.Ecr.GetRepositoryPolicy(ctx, &ecr.GetRepositoryPolicyInput{
+		RepositoryName: aws.String(repositoryName),
+	})
+
+	switch {
+	case err == nil:
+		if err := json.Unmarshal([]byte(aws.ToString(existing.PolicyText)), &current); err != nil {
+			return fmt.Errorf("repository policy of %s: %w", repositoryName, err)
+		}
+	case !isErrorCode(err, "RepositoryPolicyNotFoundException"):
+		return err
+	}
+
+	desired := policyDocument{Version: current.Version}
+	for _, statement := range current.Statement {
+		if sid := statement["Sid"]; sid != sidAccountPull && sid != sidLambdaPull {
+			desired.Statement = append(desired.Statement, statement)
+		}
+	}
+	desired.Statement = append(desired.Statement, managed...)
+
+	if equalJson(current, desired) {
+		return nil
+	}
+
+	text, err := json.Marshal(desired)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.Ecr.SetRepositoryPolicy(ctx, &ecr.SetRepositoryPolicyInput{
+		RepositoryName: aws.String(repositoryName),
+		PolicyText:     aws.String(string(text)),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("granted %v pull access to %s", s.Settings.PullAccounts, repositoryName)
+	return nil
+}
+
+// putLifecyclePolicy expires untagged images. The rule keeps its priority among any others the repository has.
+func (s Service) putLifecyclePolicy(ctx context.Context, repositoryName string) error {
+	if s.Settings.ExpireUntaggedDays == 0 {
+		return nil
+	}
+
+	var current lifecyclePolicy
+
+	existing, err := s.Client.Ecr.GetLifecyclePolicy(ctx, &ecr.GetLifecyclePolicyInput{
+		RepositoryName: aws.String(repositoryName),
+	})
+
+	switch {
+	case err == nil:
+		if err := json.Unmarshal([]byte(aws.ToString(existing.LifecyclePolicyText)), &current); err != nil {
+			return fmt.Errorf("lifecycle policy of %s: %w", repositoryName, err)
+		}
+	case !isErrorCode(err, "LifecyclePolicyNotFoundException"):
+		return err
+	}
+
+	var desired lifecyclePolicy
+	var priority float64
+
+	for _, rule := range current.Rules {
+		rulePriority, _ := rule["rulePriority"].(float64)
+		if rule["description"] == expireUntaggedId {
+			priority = rulePriority
+			continue
+		}
+		desired.Rules = append(desired.Rules, rule)
+	}
+
+	if priority == 0 {
+		for _, rule := range desired.Rules {
+			if rulePriority, _ := rule["rulePriority"].(float64); rulePriority > priority {
+				priority = rulePriority
+			}
+		}
+		priority++
+	}
+
+	desired.Rules = append(desired.Rules, map[string]any{
+		"rulePriority": priority,
+		"description":  expireUntaggedId,
+		"selection": map[string]any{
+			"tagStatus":   "untagged",
+			"countType":   "sinceImagePushed",
+			"countUnit":   "days",
+			"countNumber": s.Settings.ExpireUntaggedDays,
+		},
+		"action": map[string]any{"type": "expire"},
+	})
+
+	if equalJson(current, desired) {
+		return nil
+	}
+
+	text, err := json.Marshal(desired)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.Ecr.PutLifecyclePolicy(ctx, &ecr.PutLifecyclePolicyInput{
+		RepositoryName:      aws.String(repositoryName),
+		LifecyclePolicyText: aws.String(string(text)),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("expiring untagged images in %s after %d days", repositoryName, s.Settings.ExpireUntaggedDays)
+	return nil
+}
+
+// equalJson compares documents as ECR stores them, after a round trip through JSON.
+func equalJson(a, b any) bool {
+	left, err := roundTrip(a)
+	if err != nil {
+		return false
+	}
+
+	right, err := roundTrip(b)
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func roundTrip(v any) (any, error) {
+	var out any
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &out)
+	return out, err
+}
+
+func isErrorCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
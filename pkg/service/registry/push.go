@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// pusher uploads an archived image over the distribution API without a docker daemon.
+type pusher struct {
+	endpoint      string
+	authorization string
+	client        *http.Client
+}
+
+// Uploads can take far longer than any sensible overall timeout, so only connecting and waiting on headers are bounded.
+func uploadHttpClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 2 * time.Minute,
+		},
+	}
+}
+
+// PushArchive pushes the image in an OCI layout or tarball to ECR, authenticating with the registry's token.
+// The labels are merged into the image config before pushing, and the pushed manifest's digest is returned.
+func (s Service) PushArchive(ctx context.Context, registryId, registryUrl, repository, path string, labels map[string]string, tags []string) (string, error) {
+	token, err := s.Token(ctx, registryId)
+	if err != nil {
+		return "", err
+	}
+
+	p := pusher{
+		endpoint:      "https://" + registryUrl,
+		authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("AWS:"+token)),
+		client:        uploadHttpClient(),
+	}
+
+	return p.pushArchive(ctx, repository, path, s.Architecture, labels, tags)
+}
+
+// PushArchive pushes the image in an OCI layout or tarball to the registry.
+func (s OciService) PushArchive(ctx context.Context, registryId, registryUrl, repository, path string, labels map[string]string, tags []string) (string, error) {
+	p := pusher{
+		endpoint: s.Endpoint,
+		client:   s.uploadHttpClient(),
+	}
+
+	return p.pushArchive(ctx, repository, path, s.Architecture, labels, tags)
+}
+
+func (p pusher) pushArchive(ctx context.Context, repository, path, architecture string, labels map[string]string, tags []string) (string, error) {
+	archive, err := OpenArchive(path, architecture)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	config, manifest, mediaType, err := labelImage(archive, labels)
+	if err != nil {
+		return "", err
+	}
+
+	for _, layer := range archive.Layers {
+		open := func() (io.ReadCloser, int64, error) {
+			file, err := archive.Open(layer.Digest)
+			return file, layer.Size, err
+		}
+
+		if err := p.putBlob(ctx, repository, layer.Digest, open); err != nil {
+			return "", fmt.Errorf("layer %s: %w", layer.Digest, err)
+		}
+	}
+
+	configSum := sha256.Sum256(config)
+	if err := p.putBlob(ctx, repository, "sha256:"+hex.EncodeToString(configSum[:]), bytesOpener(config)); err != nil {
+		return "", fmt.Errorf("config: %w", err)
+	}
+
+	for _, tag := range tags {
+		if err := p.putManifest(ctx, repository, tag, mediaType, manifest); err != nil {
+			return "", fmt.Errorf("tag %s: %w", tag, err)
+		}
+		log.Info().Msgf("pushed %s:%s", repository, tag)
+	}
+
+	manifestSum := sha256.Sum256(manifest)
+	return "sha256:" + hex.EncodeToString(manifestSum[:]), nil
+}
+
+// labelImage merges labels into the image config and points the manifest at the relabelled config.
+// Unknown fields of both documents are kept as they are.
+func labelImage(archive Archive, labels map[string]string) ([]byte, []byte, string, error) {
+	var config, manifest map[string]any
+
+	if err := json.Unmarshal(archive.Config, &config); err != nil {
+		return nil, nil, "", err
+	}
+
+	if err := json.Unmarshal(archive.Manifest, &manifest); err != nil {
+		return nil, nil, "", err
+	}
+
+	containerConfig, _ := config["config"].(map[string]any)
+	if containerConfig == nil {
+		containerConfig = map[string]any{}
+		config["config"] = containerConfig
+	}
+
+	existing, _ := containerConfig["Labels"].(map[string]any)
+	if existing == nil {
+		existing = map[string]any{}
+		containerConfig["Labels"] = existing
+	}
+
+	for key, value := range labels {
+		existing[key] = value
+	}
+
+	configJson, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	sum := sha256.Sum256(configJson)
+	descriptor, _ := manifest["config"].(map[string]any)
+	if descriptor == nil {
+		return nil, nil, "", fmt.Errorf("image manifest has no config")
+	}
+	descriptor["digest"] = "sha256:" + hex.EncodeToString(sum[:])
+	descriptor["size"] = len(configJson)
+
+	manifestJson, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	mediaType, _ := manifest["mediaType"].(string)
+	if mediaType == "" {
+		mediaType = mediaTypeOciManifest
+	}
+
+	return configJson, manifestJson, mediaType, nil
+}
+
+func (p pusher) putBlob(ctx context.Context, repository, digest string, open opener) error {
+	resp, err := sendBody(ctx, p.client, http.MethodHead, p.url(repository, "blobs", digest), p.header(), nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		log.Debug().Msgf("blob %s already exists", digest)
+		return nil
+	}
+
+	resp, err = sendBody(ctx, p.client, http.MethodPost, p.url(repository, "blobs", "uploads")+"/", p.header(), nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		return apiError(resp)
+	}
+
+	location, err := p.resolve(resp.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+
+	header := p.header()
+	header.Set("Content-Type", "application/octet-stream")
+
+	resp, err = sendBody(ctx, p.client, http.MethodPatch, location.String(), header, open)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNoContent {
+		return apiError(resp)
+	}
+
+	if next := resp.Header.Get("Location"); next != "" {
+		if location, err = p.resolve(next); err != nil {
+			return err
+		}
+	}
+
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = sendBody(ctx, p.client, http.MethodPut, location.String(), p.header(), nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return apiError(resp)
+	}
+
+	return nil
+}
+
+func (p pusher) putManifest(ctx context.Context, repository, tag, mediaType string, manifest []byte) error {
+	header := p.header()
+	header.Set("Content-Type", mediaType)
+
+	resp, err := sendBody(ctx, p.client, http.MethodPut, p.url(repository, "manifests", tag), header, bytesOpener(manifest))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return apiError(resp)
+	}
+
+	return nil
+}
+
+func (p pusher) header() http.Header {
+	header := http.Header{}
+	if p.authorization != "" {
+		header.Set("Authorization", p.authorization)
+	}
+	return header
+}
+
+func (p pusher) url(repository string, parts ...string) string {
+	return OciService{Endpoint: p.endpoint}.url(repository, parts...)
+}
+
+func (p pusher) resolve(location string) (*url.URL, error) {
+	base, err := url.Parse(p.endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return base.ResolveReference(ref), nil
+}
+
+func bytesOpener(content []byte) opener {
+	return func() (io.ReadCloser, int64, error) {
+		return io.NopCloser(bytes.NewReader(content)), int64(len(content)), nil
+	}
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 )
@@ -14,20 +15,40 @@ type EcrClient interface {
 	BatchDeleteImage(ctx context.Context, params *ecr.BatchDeleteImageInput, optFns ...func(*ecr.Options)) (*ecr.BatchDeleteImageOutput, error)
 	DescribeRepositories(ctx context.Context, params *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error)
 	CreateRepository(ctx context.Context, params *ecr.CreateRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error)
+	PutImageScanningConfiguration(ctx context.Context, params *ecr.PutImageScanningConfigurationInput, optFns ...func(*ecr.Options)) (*ecr.PutImageScanningConfigurationOutput, error)
+	DescribeImageScanFindings(ctx context.Context, params *ecr.DescribeImageScanFindingsInput, optFns ...func(*ecr.Options)) (*ecr.DescribeImageScanFindingsOutput, error)
+	StartImageScan(ctx context.Context, params *ecr.StartImageScanInput, optFns ...func(*ecr.Options)) (*ecr.StartImageScanOutput, error)
+	GetRepositoryPolicy(ctx context.Context, params *ecr.GetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.GetRepositoryPolicyOutput, error)
+	SetRepositoryPolicy(ctx context.Context, params *ecr.SetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.SetRepositoryPolicyOutput, error)
+	GetLifecyclePolicy(ctx context.Context, params *ecr.GetLifecyclePolicyInput, optFns ...func(*ecr.Options)) (*ecr.GetLifecyclePolicyOutput, error)
+	PutLifecyclePolicy(ctx context.Context, params *ecr.PutLifecyclePolicyInput, optFns ...func(*ecr.Options)) (*ecr.PutLifecyclePolicyOutput, error)
 }
 
 type Client struct {
-	Ecr EcrClient
+	Ecr  EcrClient
+	Http *http.Client
 }
 
 type Service struct {
-	Client Client
+	Client   Client
+	Cache    *Cache
+	Settings Settings
+	// Architecture picks the image read from an index, empty takes the first linux image.
+	Architecture string
 }
 
-func FromClients(ecrClient EcrClient) Service {
+func FromClients(ecrClient EcrClient, cache *Cache) Service {
 	return Service{
 		Client: Client{
-			Ecr: ecrClient,
+			Ecr:  ecrClient,
+			Http: defaultHttpClient(),
 		},
+		Cache: cache,
 	}
 }
+
+// WithArchitecture reads the image of this architecture from image indexes, e.g. arm64.
+func (s Service) WithArchitecture(architecture string) Service {
+	s.Architecture = architecture
+	return s
+}
@@ -6,21 +6,60 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"github.com/aws/smithy-go"
 )
 
+// PutRepository ensures the repository exists, then reconciles its repository and lifecycle policies with the settings.
 func (s Service) PutRepository(ctx context.Context, repositoryName string) error {
+	if err := s.ensureRepository(ctx, repositoryName); err != nil {
+		return err
+	}
+
+	if err := s.putRepositoryPolicy(ctx, repositoryName); err != nil {
+		return err
+	}
+
+	return s.putLifecyclePolicy(ctx, repositoryName)
+}
+
+// ensureRepository creates the repository with scan-on-push enabled, and enables it on repositories created without.
+func (s Service) ensureRepository(ctx context.Context, repositoryName string) error {
 	var apiErr smithy.APIError
 
-	_, err := s.Client.Ecr.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
+	described, err := s.Client.Ecr.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
 		RepositoryNames: []string{repositoryName},
 	})
 
+	if err == nil {
+		for _, repository := range described.Repositories {
+			if repository.ImageScanningConfiguration != nil && repository.ImageScanningConfiguration.ScanOnPush {
+				continue
+			}
+
+			_, err = s.Client.Ecr.PutImageScanningConfiguration(ctx, &ecr.PutImageScanningConfigurationInput{
+				RepositoryName: repository.RepositoryName,
+				ImageScanningConfiguration: &types.ImageScanningConfiguration{
+					ScanOnPush: true,
+				},
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
 	if errors.As(err, &apiErr) {
 		switch apiErr.ErrorCode() {
 		case "RepositoryNotFoundException":
 			_, err = s.Client.Ecr.CreateRepository(ctx, &ecr.CreateRepositoryInput{
 				RepositoryName: aws.String(repositoryName),
+				ImageScanningConfiguration: &types.ImageScanningConfiguration{
+					ScanOnPush: true,
+				},
 			})
 
 			if err != nil {
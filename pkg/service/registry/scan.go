@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
+)
+
+// scanTimeout bounds the wait for a scan, basic scans usually complete within a couple of minutes.
+const scanTimeout = 10 * time.Minute
+
+// ScanFindings waits for the image's scan to complete and returns its findings, all pages merged into one output.
+// Images pushed before scan-on-push was enabled are scanned first.
+func (s Service) ScanFindings(ctx context.Context, registryId, repository, digest string) (*ecr.DescribeImageScanFindingsOutput, error) {
+	digest, err := s.scannedDigest(ctx, registryId, repository, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &ecr.DescribeImageScanFindingsInput{
+		RegistryId:     aws.String(registryId),
+		RepositoryName: aws.String(repository),
+		ImageId: &ecrTypes.ImageIdentifier{
+			ImageDigest: aws.String(digest),
+		},
+	}
+
+	if err := s.awaitScan(ctx, input); err != nil {
+		return nil, fmt.Errorf("scan of %s@%s: %w", repository, digest, err)
+	}
+
+	var merged *ecr.DescribeImageScanFindingsOutput
+
+	paginator := ecr.NewDescribeImageScanFindingsPaginator(s.Client.Ecr, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case merged == nil:
+			merged = page
+		case merged.ImageScanFindings == nil:
+			merged.ImageScanFindings = page.ImageScanFindings
+		case page.ImageScanFindings != nil:
+			merged.ImageScanFindings.Findings = append(merged.ImageScanFindings.Findings, page.ImageScanFindings.Findings...)
+			merged.ImageScanFindings.EnhancedFindings = append(merged.ImageScanFindings.EnhancedFindings, page.ImageScanFindings.EnhancedFindings...)
+		}
+	}
+
+	if merged == nil {
+		return &ecr.DescribeImageScanFindingsOutput{}, nil
+	}
+
+	merged.NextToken = nil
+	return merged, nil
+}
+
+// scannedDigest resolves the digest ECR scanned. Indexes, as buildx pushes them, are not scanned themselves,
+// so the image of the configured architecture is scanned, the one inspect reads the release from.
+func (s Service) scannedDigest(ctx context.Context, registryId, repository, digest string) (string, error) {
+	output, err := s.Client.Ecr.BatchGetImage(ctx, &ecr.BatchGetImageInput{
+		RegistryId:         aws.String(registryId),
+		RepositoryName:     aws.String(repository),
+		ImageIds:           []ecrTypes.ImageIdentifier{{ImageDigest: aws.String(digest)}},
+		AcceptedMediaTypes: acceptedMediaTypes,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(output.Images) == 0 {
+		return "", &smithy.GenericAPIError{Code: "ImageNotFoundException", Message: "no such release found for digest " + digest}
+	}
+
+	platformDigest, err := platformManifest([]byte(aws.ToString(output.Images[0].ImageManifest)), s.Architecture)
+	if err != nil || platformDigest == "" {
+		return digest, err
+	}
+
+	log.Debug().Msgf("scanning %s, the image of index %s", platformDigest, digest)
+	return platformDigest, nil
+}
+
+// awaitScan polls until the scan completes. ECR's own waiter retries on every error and does not know
+// the statuses of enhanced scanning, so it cannot be used here.
+func (s Service) awaitScan(ctx context.Context, input *ecr.DescribeImageScanFindingsInput) error {
+	var apiErr smithy.APIError
+	started := false
+	deadline := time.Now().Add(scanTimeout)
+
+	for {
+		output, err := s.Client.Ecr.DescribeImageScanFindings(ctx, &ecr.DescribeImageScanFindingsInput{
+			RegistryId:     input.RegistryId,
+			RepositoryName: input.RepositoryName,
+			ImageId:        input.ImageId,
+			MaxResults:     aws.Int32(1),
+		})
+
+		switch {
+		case errors.As(err, &apiErr) && apiErr.ErrorCode() == "ScanNotFoundException" && !started:
+			log.Info().Msgf("no scan found for %s, starting one", aws.ToString(input.ImageId.ImageDigest))
+			if _, err := s.Client.Ecr.StartImageScan(ctx, &ecr.StartImageScanInput{
+				RegistryId:     input.RegistryId,
+				RepositoryName: input.RepositoryName,
+				ImageId:        input.ImageId,
+			}); err != nil {
+				return err
+			}
+			started = true
+		case err != nil:
+			return err
+		case output.ImageScanStatus == nil:
+			return fmt.Errorf("no scan status reported")
+		default:
+			switch output.ImageScanStatus.Status {
+			case ecrTypes.ScanStatusComplete, ecrTypes.ScanStatusActive:
+				return nil
+			case ecrTypes.ScanStatusInProgress, ecrTypes.ScanStatusPending:
+				log.Debug().Msgf("scan is %s", output.ImageScanStatus.Status)
+			default:
+				return fmt.Errorf("scan is %s: %s", output.ImageScanStatus.Status, aws.ToString(output.ImageScanStatus.Description))
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("scan did not complete within %s", scanTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/smithy-go"
+	"github.com/rs/zerolog/log"
+)
+
+const mediaTypeSignature = "application/vnd.linecard.self.signature.v1+json"
+
+// SignatureTag tags the signature of the release with the given digest, beside it in the same repository.
+// The suffix keeps clear of the tags cosign signs with.
+func SignatureTag(digest string) string {
+	return "sha256-" + strings.TrimPrefix(digest, "sha256:") + ".self.sig"
+}
+
+// IsSignatureTag reports whether a tag holds a release signature rather than a release.
+func IsSignatureTag(tag string) bool {
+	return strings.HasPrefix(tag, "sha256-") && strings.HasSuffix(tag, ".self.sig")
+}
+
+// PutSignature pushes the signature of a release as a single layer artifact, tagged by SignatureTag.
+func (s Service) PutSignature(ctx context.Context, registryId, registryUrl, repository, digest string, signature []byte) error {
+	token, err := s.Token(ctx, registryId)
+	if err != nil {
+		return err
+	}
+
+	p := pusher{
+		endpoint:      "https://" + registryUrl,
+		authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("AWS:"+token)),
+		client:        uploadHttpClient(),
+	}
+
+	return p.pushSignature(ctx, repository, SignatureTag(digest), signature)
+}
+
+// Signature reads the signature of a release, ImageNotFoundException when it has none.
+func (s Service) Signature(ctx context.Context, registryId, repository, digest string) ([]byte, error) {
+	output, err := s.Client.Ecr.BatchGetImage(ctx, &ecr.BatchGetImageInput{
+		RegistryId:         aws.String(registryId),
+		RepositoryName:     aws.String(repository),
+		ImageIds:           []ecrTypes.ImageIdentifier{{ImageTag: aws.String(SignatureTag(digest))}},
+		AcceptedMediaTypes: []string{mediaTypeOciManifest},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.Images) == 0 {
+		return nil, &smithy.GenericAPIError{Code: "ImageNotFoundException", Message: "no signature found for digest " + digest}
+	}
+
+	layer, err := signatureLayer([]byte(aws.ToString(output.Images[0].ImageManifest)))
+	if err != nil {
+		return nil, err
+	}
+
+	download, err := s.Client.Ecr.GetDownloadUrlForLayer(ctx, &ecr.GetDownloadUrlForLayerInput{
+		RegistryId:     aws.String(registryId),
+		RepositoryName: aws.String(repository),
+		LayerDigest:    aws.String(layer),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.fetchBlob(ctx, aws.ToString(download.DownloadUrl))
+}
+
+// DeleteSignature removes the signature of a release. ECR deletes an image along with its last tag.
+func (s Service) DeleteSignature(ctx context.Context, registryId, repository, digest string) error {
+	return s.Untag(ctx, registryId, repository, SignatureTag(digest))
+}
+
+// PutSignature pushes the signature of a release to the registry.
+func (s OciService) PutSignature(ctx context.Context, registryId, registryUrl, repository, digest string, signature []byte) error {
+	p := pusher{
+		endpoint: s.Endpoint,
+		client:   s.uploadHttpClient(),
+	}
+
+	return p.pushSignature(ctx, repository, SignatureTag(digest), signature)
+}
+
+func (s OciService) Signature(ctx context.Context, registryId, repository, digest string) ([]byte, error) {
+	resp, err := send(ctx, s.Http, http.MethodGet, s.url(repository, "manifests", SignatureTag(digest)), http.Header{
+		"Accept": []string{mediaTypeOciManifest},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	layer, err := signatureLayer(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err = send(ctx, s.Http, http.MethodGet, s.url(repository, "blobs", layer), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	return resp.Body, nil
+}
+
+func (s OciService) DeleteSignature(ctx context.Context, registryId, repository, digest string) error {
+	return s.Untag(ctx, registryId, repository, SignatureTag(digest))
+}
+
+// pushSignature uploads the signature as the only layer of an OCI artifact, with a config
+// registries that expect an image, like ECR, accept.
+func (p pusher) pushSignature(ctx context.Context, repository, tag string, signature []byte) error {
+	layerSum := sha256.Sum256(signature)
+	layerDigest := "sha256:" + hex.EncodeToString(layerSum[:])
+
+	if err := p.putBlob(ctx, repository, layerDigest, bytesOpener(signature)); err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+
+	config, err := json.Marshal(map[string]any{
+		"architecture": "",
+		"os":           "",
+		"config":       map[string]any{},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": []string{layerDigest}},
+	})
+	if err != nil {
+		return err
+	}
+
+	configSum := sha256.Sum256(config)
+	configDigest := "sha256:" + hex.EncodeToString(configSum[:])
+
+	if err := p.putBlob(ctx, repository, configDigest, bytesOpener(config)); err != nil {
+		return fmt.Errorf("signature config: %w", err)
+	}
+
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOciManifest,
+		"config": map[string]any{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    configDigest,
+			"size":      len(config),
+		},
+		"layers": []map[string]any{{
+			"mediaType": mediaTypeSignature,
+			"digest":    layerDigest,
+			"size":      len(signature),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := p.putManifest(ctx, repository, tag, mediaTypeOciManifest, manifest); err != nil {
+		return err
+	}
+
+	log.Info().Msgf("pushed %s:%s", repository, tag)
+	return nil
+}
+
+func signatureLayer(manifest []byte) (string, error) {
+	var distributionManifest DistributionManifest
+
+	if err := json.Unmarshal(manifest, &distributionManifest); err != nil {
+		return "", err
+	}
+
+	for _, layer := range distributionManifest.Layers {
+		if layer.MediaType == mediaTypeSignature {
+			return layer.Digest, nil
+		}
+	}
+
+	return "", fmt.Errorf("manifest holds no signature")
+}
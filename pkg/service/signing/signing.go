@@ -0,0 +1,225 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+const (
+	AlgorithmEd25519 = "ed25519"
+	AlgorithmEcdsa   = "ecdsa-p256-sha256"
+	// KmsPrefix marks a key held in KMS, e.g. awskms:///arn:aws:kms:us-east-1:111111111111:key/...
+	KmsPrefix = "awskms:///"
+)
+
+type KmsClient interface {
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+	Verify(ctx context.Context, params *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error)
+}
+
+type Clients struct {
+	Kms KmsClient
+}
+
+type Service struct {
+	Client Clients
+}
+
+// Signature is stored beside a release. It names the key that made it, the payload is rebuilt from the release to verify.
+type Signature struct {
+	KeyId     string `json:"keyId"`
+	Algorithm string `json:"algorithm"`
+	Signature []byte `json:"signature"`
+}
+
+func FromClients(kmsClient KmsClient) Service {
+	return Service{
+		Client: Clients{
+			Kms: kmsClient,
+		},
+	}
+}
+
+// Sign signs the payload with an ed25519 or P-256 key, given as a PEM file, PEM content or a KMS key.
+// KMS keys must be ECC_NIST_P256 signing keys.
+func (s Service) Sign(ctx context.Context, key string, payload []byte) (Signature, error) {
+	digest := sha256.Sum256(payload)
+
+	if keyId, found := strings.CutPrefix(key, KmsPrefix); found {
+		output, err := s.Client.Kms.Sign(ctx, &kms.SignInput{
+			KeyId:            aws.String(keyId),
+			Message:          digest[:],
+			MessageType:      types.MessageTypeDigest,
+			SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+		})
+
+		if err != nil {
+			return Signature{}, err
+		}
+
+		return Signature{
+			KeyId:     KmsPrefix + aws.ToString(output.KeyId),
+			Algorithm: AlgorithmEcdsa,
+			Signature: output.Signature,
+		}, nil
+	}
+
+	private, err := privateKey(key)
+	if err != nil {
+		return Signature{}, err
+	}
+
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		return Signature{
+			KeyId:     Fingerprint(private.Public()),
+			Algorithm: AlgorithmEd25519,
+			Signature: ed25519.Sign(private, payload),
+		}, nil
+
+	case *ecdsa.PrivateKey:
+		if private.Curve != elliptic.P256() {
+			return Signature{}, fmt.Errorf("ecdsa signing keys must be P-256")
+		}
+
+		signature, err := ecdsa.SignASN1(rand.Reader, private, digest[:])
+		if err != nil {
+			return Signature{}, err
+		}
+
+		return Signature{
+			KeyId:     Fingerprint(private.Public()),
+			Algorithm: AlgorithmEcdsa,
+			Signature: signature,
+		}, nil
+
+	default:
+		return Signature{}, fmt.Errorf("signing keys must be ed25519 or ecdsa P-256, got %T", private)
+	}
+}
+
+// Verify checks the signature was made over the payload by one of the trusted keys. Trusted keys are KMS keys,
+// PEM public key files, or base64 DER public keys.
+func (s Service) Verify(ctx context.Context, trusted []string, payload []byte, signature Signature) error {
+	digest := sha256.Sum256(payload)
+
+	for _, key := range trusted {
+		if strings.HasPrefix(key, KmsPrefix) {
+			if key != signature.KeyId {
+				continue
+			}
+
+			output, err := s.Client.Kms.Verify(ctx, &kms.VerifyInput{
+				KeyId:            aws.String(strings.TrimPrefix(key, KmsPrefix)),
+				Message:          digest[:],
+				MessageType:      types.MessageTypeDigest,
+				Signature:        signature.Signature,
+				SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+			})
+
+			var invalid *types.KMSInvalidSignatureException
+			switch {
+			case errors.As(err, &invalid):
+				return fmt.Errorf("signature by %s does not match the release", key)
+			case err != nil:
+				return err
+			case output.SignatureValid:
+				return nil
+			default:
+				return fmt.Errorf("signature by %s does not match the release", key)
+			}
+		}
+
+		public, err := publicKey(key)
+		if err != nil {
+			return err
+		}
+
+		if Fingerprint(public) != signature.KeyId {
+			continue
+		}
+
+		valid := false
+		switch public := public.(type) {
+		case ed25519.PublicKey:
+			valid = signature.Algorithm == AlgorithmEd25519 && ed25519.Verify(public, payload, signature.Signature)
+		case *ecdsa.PublicKey:
+			valid = signature.Algorithm == AlgorithmEcdsa && ecdsa.VerifyASN1(public, digest[:], signature.Signature)
+		}
+
+		if !valid {
+			return fmt.Errorf("signature by %s does not match the release", signature.KeyId)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("release is signed by %s, which is not trusted", signature.KeyId)
+}
+
+// Fingerprint identifies a public key by the sha256 of its DER encoding.
+func Fingerprint(public crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func privateKey(key string) (crypto.PrivateKey, error) {
+	content := []byte(key)
+	if !strings.HasPrefix(key, "-----BEGIN") {
+		var err error
+		if content, err = os.ReadFile(key); err != nil {
+			return nil, fmt.Errorf("signing key: %w", err)
+		}
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("signing key is not PEM encoded")
+	}
+
+	if block.Type == "EC PRIVATE KEY" {
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func publicKey(key string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(key)
+
+	if content, readErr := os.ReadFile(key); readErr == nil {
+		block, _ := pem.Decode(content)
+		if block == nil {
+			return nil, fmt.Errorf("trusted key %s is not PEM encoded", key)
+		}
+		der, err = block.Bytes, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("trusted key %q is neither a KMS key, a PEM file nor base64 DER", key)
+	}
+
+	return x509.ParsePKIXPublicKey(der)
+}